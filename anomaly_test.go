@@ -9,8 +9,10 @@ import (
 	"math/rand"
 	"testing"
 
+	"github.com/pointlander/anomaly/attention"
 	"github.com/pointlander/anomaly/gru"
 	"github.com/pointlander/anomaly/lstm"
+	"github.com/pointlander/anomaly/rnn"
 )
 
 func BenchmarkLFSR(b *testing.B) {
@@ -129,6 +131,23 @@ func BenchmarkAutoencoder(b *testing.B) {
 	}
 }
 
+func BenchmarkVAE(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	vectorizer := NewVectorizer(1024, true, NewLFSR32Source)
+	network := NewVAE(rnd, vectorizer)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		object := GenerateRandomJSON(rnd)
+		input, err := json.Marshal(object)
+		if err != nil {
+			panic(err)
+		}
+		b.StartTimer()
+		network.Train(input)
+	}
+}
+
 func BenchmarkLSTM(b *testing.B) {
 	rnd := rand.New(rand.NewSource(1))
 	network := lstm.NewLSTM(rnd)
@@ -161,6 +180,84 @@ func BenchmarkGRU(b *testing.B) {
 	}
 }
 
+func BenchmarkAttention(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	network := attention.NewAttention(rnd)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		object := GenerateRandomJSON(rnd)
+		data, err := json.Marshal(object)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		network.Train(data)
+	}
+}
+
+func BenchmarkBidirectional(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	network := lstm.NewBidirectional(rnd, lstm.DefaultOptions())
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		object := GenerateRandomJSON(rnd)
+		data, err := json.Marshal(object)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		network.Train(data)
+	}
+}
+
+func benchmarkRNN(b *testing.B, cell rnn.Cell) {
+	rnd := rand.New(rand.NewSource(1))
+	network := rnn.NewEngine(rnd, cell, rnn.DefaultOptions())
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		object := GenerateRandomJSON(rnd)
+		data, err := json.Marshal(object)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		network.Train(data)
+	}
+}
+
+func BenchmarkElman(b *testing.B) {
+	benchmarkRNN(b, rnn.Elman{})
+}
+
+func BenchmarkMGU(b *testing.B) {
+	benchmarkRNN(b, rnn.MGU{})
+}
+
+func BenchmarkIndRNN(b *testing.B) {
+	benchmarkRNN(b, rnn.IndRNN{})
+}
+
+func BenchmarkRecurrentEmbedding(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	factory := NewRecurrentEmbeddingFactory(rnn.LSTM{}, rnn.DefaultOptions(),
+		rnn.PoolingMean, NewAverageSimilarity)
+	network := factory(rnd, nil)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		object := GenerateRandomJSON(rnd)
+		data, err := json.Marshal(object)
+		if err != nil {
+			b.Fatal(err)
+		}
+		b.StartTimer()
+		network.Train(data)
+	}
+}
+
 func BenchmarkComplexity(b *testing.B) {
 	rnd := rand.New(rand.NewSource(1))
 	vectorizer := NewVectorizer(1024, true, NewLFSR32Source)
@@ -177,3 +274,126 @@ func BenchmarkComplexity(b *testing.B) {
 		network.Train(data)
 	}
 }
+
+func BenchmarkLOF(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	vectorizer := NewVectorizer(1024, true, NewLFSR32Source)
+	network := NewLOF(rnd, vectorizer)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		object := GenerateRandomJSON(rnd)
+		input, err := json.Marshal(object)
+		if err != nil {
+			panic(err)
+		}
+		b.StartTimer()
+		network.Train(input)
+	}
+}
+
+func BenchmarkNovelty(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	vectorizer := NewVectorizer(1024, true, NewLFSR32Source)
+	network := NewNovelty(rnd, vectorizer)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		object := GenerateRandomJSON(rnd)
+		input, err := json.Marshal(object)
+		if err != nil {
+			panic(err)
+		}
+		b.StartTimer()
+		network.Train(input)
+	}
+}
+
+func BenchmarkFieldStatistics(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	vectorizer := NewVectorizer(1024, true, NewLFSR32Source)
+	network := NewFieldStatistics(rnd, vectorizer)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		object := GenerateRandomJSON(rnd)
+		input, err := json.Marshal(object)
+		if err != nil {
+			panic(err)
+		}
+		b.StartTimer()
+		network.Train(input)
+	}
+}
+
+func BenchmarkSchema(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	vectorizer := NewVectorizer(1024, true, NewLFSR32Source)
+	network := NewSchema(rnd, vectorizer)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		object := GenerateRandomJSON(rnd)
+		input, err := json.Marshal(object)
+		if err != nil {
+			panic(err)
+		}
+		b.StartTimer()
+		network.Train(input)
+	}
+}
+
+func BenchmarkCoOccurrence(b *testing.B) {
+	rnd := rand.New(rand.NewSource(1))
+	vectorizer := NewVectorizer(1024, true, NewLFSR32Source)
+	network := NewCoOccurrence(rnd, vectorizer)
+	b.ResetTimer()
+	for n := 0; n < b.N; n++ {
+		b.StopTimer()
+		object := GenerateRandomJSON(rnd)
+		input, err := json.Marshal(object)
+		if err != nil {
+			panic(err)
+		}
+		b.StartTimer()
+		network.Train(input)
+	}
+}
+
+// TestNodes checks that the count of nodes kept by a CDF16 matches its
+// context tree, after learning and after loading
+func TestNodes(t *testing.T) {
+	count := func(c *CDF16) int {
+		var count func(n *Node16) int
+		count = func(n *Node16) int {
+			nodes := 1
+			for _, child := range n.Children {
+				nodes += count(child)
+			}
+			return nodes
+		}
+		return count(c.Root)
+	}
+
+	complexity := NewComplexity(nil, nil).(*Complexity)
+	if nodes := complexity.Nodes(); nodes != 1 {
+		t.Errorf("new model has %d nodes, not 1", nodes)
+	}
+	complexity.Train([]byte(`{"user":"alice","action":"login"}`))
+	complexity.Train([]byte(`{"user":"bob","action":"login"}`))
+	if nodes, expected := complexity.Nodes(), count(complexity.CDF16); nodes != expected || nodes < 2 {
+		t.Errorf("model has %d nodes, not %d", nodes, expected)
+	}
+
+	data, err := json.Marshal(complexity)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var loaded Complexity
+	if err = json.Unmarshal(data, &loaded); err != nil {
+		t.Fatal(err)
+	}
+	if nodes, expected := loaded.Nodes(), complexity.Nodes(); nodes != expected {
+		t.Errorf("loaded model has %d nodes, not %d", nodes, expected)
+	}
+}
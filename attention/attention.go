@@ -0,0 +1,403 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package attention
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"strconv"
+
+	"github.com/chewxy/hm"
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+
+	"github.com/pointlander/anomaly/rnn"
+)
+
+// symbols is the number of byte values
+const symbols = 256
+
+// Options are the hyperparameters of the attention model
+type Options struct {
+	// Window is the number of bytes attended to, the cost of each byte is
+	// computed from the bytes before it in its window
+	Window int
+	// Size is the size of the embeddings and of the attention
+	Size int
+	// Layers is the number of transformer layers
+	Layers int
+	// Hidden is the size of the feed forward networks
+	Hidden int
+
+	Solver    rnn.Solver
+	LearnRate float64
+	L2Reg     float64
+	Clip      float64
+	Momentum  float64
+}
+
+// DefaultOptions returns the default hyperparameters of the attention model
+func DefaultOptions() Options {
+	return Options{
+		Window:    32,
+		Size:      32,
+		Layers:    2,
+		Hidden:    64,
+		Solver:    rnn.SolverRMSProp,
+		LearnRate: 0.001,
+		L2Reg:     0.000001,
+		Clip:      5.0,
+		Momentum:  0.9,
+	}
+}
+
+// ErrSizes is returned for options with a window, size, number of layers or
+// hidden size below 1
+var ErrSizes = errors.New("window, size, layers and hidden size must be at least 1")
+
+// Validate checks the options
+func (o *Options) Validate() error {
+	if o.Window < 1 || o.Size < 1 || o.Layers < 1 || o.Hidden < 1 {
+		return ErrSizes
+	}
+	return nil
+}
+
+// weight is a named weight of the model
+type weight struct {
+	name  string
+	value *tensor.Dense
+}
+
+// gaussian creates a normally distributed weight matrix
+func gaussian(rnd *rand.Rand, name string, rows, cols int) weight {
+	data, stdev := make([]float32, rows*cols), math.Sqrt(2/float64(rows+cols))
+	for i := range data {
+		data[i] = float32(rnd.NormFloat64() * stdev)
+	}
+	return weight{
+		name:  name,
+		value: tensor.New(tensor.WithShape(rows, cols), tensor.WithBacking(data)),
+	}
+}
+
+// zeros creates a zero bias row vector
+func zeros(name string, size int) weight {
+	return weight{
+		name:  name,
+		value: tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(1, size)),
+	}
+}
+
+// rowMaxOp computes the maximum of each row of a matrix as a column. It has no
+// gradient, so it can only shift values whose gradients don't depend on the
+// shift
+type rowMaxOp struct{}
+
+func (rowMaxOp) Arity() int { return 1 }
+
+func (rowMaxOp) Type() hm.Type {
+	a := hm.TypeVariable('a')
+	return hm.NewFnType(&G.TensorType{Dims: 2, Of: a}, &G.TensorType{Dims: 2, Of: a})
+}
+
+func (rowMaxOp) InferShape(inputs ...G.DimSizer) (tensor.Shape, error) {
+	rows, err := inputs[0].DimSize(0)
+	return tensor.Shape{rows, 1}, err
+}
+
+func (rowMaxOp) Do(inputs ...G.Value) (G.Value, error) {
+	x, ok := inputs[0].(*tensor.Dense)
+	if !ok || x.Dims() != 2 {
+		return nil, fmt.Errorf("row max of %v", inputs[0])
+	}
+	rows, cols := x.Shape()[0], x.Shape()[1]
+	data := x.Data().([]float32)
+	max := make([]float32, rows)
+	for i := range max {
+		max[i] = data[i*cols]
+		for _, v := range data[i*cols : (i+1)*cols] {
+			if v > max[i] {
+				max[i] = v
+			}
+		}
+	}
+	return tensor.New(tensor.WithShape(rows, 1), tensor.WithBacking(max)), nil
+}
+
+func (rowMaxOp) ReturnsPtr() bool      { return false }
+func (rowMaxOp) CallsExtern() bool     { return false }
+func (rowMaxOp) OverwritesInput() int  { return -1 }
+func (rowMaxOp) WriteHash(h hash.Hash) { h.Write([]byte("RowMax")) }
+func (rowMaxOp) String() string        { return "RowMax" }
+
+// DiffWRT keeps the gradient from flowing through the op
+func (rowMaxOp) DiffWRT(inputs int) []bool { return make([]bool, inputs) }
+
+func (rowMaxOp) SymDiff(inputs G.Nodes, output, grad *G.Node) (G.Nodes, error) {
+	return nil, errors.New("row max has no gradient")
+}
+
+func (rowMaxOp) Hashcode() uint32 {
+	h := fnv.New32a()
+	h.Write([]byte("RowMax"))
+	return h.Sum32()
+}
+
+// shift subtracts the maximum of each row of x from the row, so the
+// exponentials of the row can't overflow. The shift doesn't change the
+// softmax of a row or its gradient
+func shift(x *G.Node) *G.Node {
+	a, max, err := G.Broadcast(x, G.Must(G.ApplyOp(rowMaxOp{}, x)), G.NewBroadcastPattern(nil, []byte{1}))
+	if err != nil {
+		panic(err)
+	}
+	return G.Must(G.Sub(a, max))
+}
+
+// softmax computes the softmax of each row of x
+func softmax(x *G.Node) *G.Node {
+	return G.Must(G.SoftMax(shift(x)))
+}
+
+// logSoftmax computes the log of the softmax of each row of x, it stays
+// finite where the softmax underflows
+func logSoftmax(x *G.Node) *G.Node {
+	shifted := shift(x)
+	sum := G.Must(G.Log(G.Must(G.Sum(G.Must(G.Exp(shifted)), 1))))
+	a, b, err := G.Broadcast(shifted, sum, G.NewBroadcastPattern(nil, []byte{1}))
+	if err != nil {
+		panic(err)
+	}
+	return G.Must(G.Sub(a, b))
+}
+
+// graph is a causal transformer over a window of bytes
+type graph struct {
+	g             *G.ExprGraph
+	learnables    G.Nodes
+	input, target *tensor.Dense
+	losses        *G.Node
+	machine       G.VM
+}
+
+// newGraph builds the graph of the model, the gradients are computed when
+// learning
+func newGraph(weights []weight, options Options, learn bool) *graph {
+	g := &graph{
+		g:      G.NewGraph(),
+		input:  tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(options.Window, symbols)),
+		target: tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(options.Window, symbols)),
+	}
+	nodes := make(G.Nodes, len(weights))
+	for i, w := range weights {
+		nodes[i] = G.NodeFromAny(g.g, w.value, G.WithName(w.name))
+	}
+	g.learnables = nodes
+
+	mask := make([]float32, options.Window*options.Window)
+	for i := 0; i < options.Window; i++ {
+		for j := i + 1; j < options.Window; j++ {
+			mask[i*options.Window+j] = -1e9
+		}
+	}
+	causal := G.NewMatrix(g.g, tensor.Float32, G.WithName("mask"), G.WithShape(options.Window, options.Window),
+		G.WithValue(tensor.New(tensor.WithShape(options.Window, options.Window), tensor.WithBacking(mask))))
+	scale := G.NewConstant(float32(1 / math.Sqrt(float64(options.Size))))
+	input := G.NewMatrix(g.g, tensor.Float32, G.WithName("input"),
+		G.WithShape(options.Window, symbols), G.WithValue(g.input))
+	target := G.NewMatrix(g.g, tensor.Float32, G.WithName("target"),
+		G.WithShape(options.Window, symbols), G.WithValue(g.target))
+	bias := func(x, b *G.Node) *G.Node {
+		return G.Must(G.BroadcastAdd(x, b, nil, []byte{0}))
+	}
+
+	h := G.Must(G.Add(G.Must(G.Mul(input, nodes[0])), nodes[1]))
+	for i := 0; i < options.Layers; i++ {
+		w := nodes[2+i*8 : 2+(i+1)*8]
+		q := G.Must(G.Mul(h, w[0]))
+		k := G.Must(G.Mul(h, w[1]))
+		v := G.Must(G.Mul(h, w[2]))
+		scores := G.Must(G.Mul(G.Must(G.Mul(q, G.Must(G.Transpose(k)))), scale))
+		attention := softmax(G.Must(G.Add(scores, causal)))
+		h = G.Must(G.Add(h, G.Must(G.Mul(G.Must(G.Mul(attention, v)), w[3]))))
+
+		f := G.Must(G.Rectify(bias(G.Must(G.Mul(h, w[4])), w[5])))
+		h = G.Must(G.Add(h, bias(G.Must(G.Mul(f, w[6])), w[7])))
+	}
+	last := nodes[len(nodes)-2:]
+	logprob := G.Must(G.Neg(logSoftmax(bias(G.Must(G.Mul(h, last[0])), last[1]))))
+	g.losses = G.Must(G.Sum(G.Must(G.HadamardProd(logprob, target)), 1))
+
+	if learn {
+		cost := G.Must(G.Sum(g.losses))
+		_, err := G.Grad(cost, g.learnables...)
+		if err != nil {
+			panic(err)
+		}
+		g.machine = G.NewTapeMachine(g.g, G.BindDualValues(g.learnables...))
+	} else {
+		g.machine = G.NewTapeMachine(g.g)
+	}
+	return g
+}
+
+// Attention is a byte model built on causal self-attention
+// https://arxiv.org/abs/1706.03762
+type Attention struct {
+	learner, scorer *graph
+	optimizer       *rnn.Optimizer
+	window          int
+}
+
+// NewAttention creates a new attention model with the default
+// hyperparameters
+func NewAttention(rnd *rand.Rand) *Attention {
+	return NewAttentionWithOptions(rnd, DefaultOptions())
+}
+
+// NewAttentionWithOptions creates a new attention model with the given
+// hyperparameters, it panics if the options aren't valid
+func NewAttentionWithOptions(rnd *rand.Rand, options Options) *Attention {
+	if err := options.Validate(); err != nil {
+		panic(err)
+	}
+	weights := []weight{
+		gaussian(rnd, "embedding", symbols, options.Size),
+		gaussian(rnd, "position", options.Window, options.Size),
+	}
+	for i := 0; i < options.Layers; i++ {
+		layer := strconv.Itoa(i)
+		weights = append(weights,
+			gaussian(rnd, "wq_"+layer, options.Size, options.Size),
+			gaussian(rnd, "wk_"+layer, options.Size, options.Size),
+			gaussian(rnd, "wv_"+layer, options.Size, options.Size),
+			gaussian(rnd, "wo_"+layer, options.Size, options.Size),
+			gaussian(rnd, "w1_"+layer, options.Size, options.Hidden),
+			zeros("b1_"+layer, options.Hidden),
+			gaussian(rnd, "w2_"+layer, options.Hidden, options.Size),
+			zeros("b2_"+layer, options.Size),
+		)
+	}
+	weights = append(weights,
+		gaussian(rnd, "decoder", options.Size, symbols),
+		zeros("bias_d", symbols),
+	)
+
+	optimizer := rnn.Options{
+		Solver:    options.Solver,
+		LearnRate: options.LearnRate,
+		L2Reg:     options.L2Reg,
+		Clip:      options.Clip,
+		Momentum:  options.Momentum,
+	}
+	return &Attention{
+		learner:   newGraph(weights, options, true),
+		scorer:    newGraph(weights, options, false),
+		optimizer: optimizer.NewOptimizer(),
+		window:    options.Window,
+	}
+}
+
+// costs computes the cost of predicting each byte of the input from the bytes
+// before it in its window, learning from each window after its cost is
+// computed
+func (a *Attention) costs(input []byte, learn bool) []float32 {
+	g := a.scorer
+	if learn {
+		g = a.learner
+	}
+	costs := make([]float32, 0, len(input))
+	for x := 0; x+1 < len(input); x += a.window {
+		g.input.Zero()
+		g.target.Zero()
+		count := 0
+		for j := 0; j < a.window && x+j+1 < len(input); j++ {
+			g.input.SetAt(float32(1), j, int(input[x+j]))
+			g.target.SetAt(float32(1), j, int(input[x+j+1]))
+			count++
+		}
+
+		err := g.machine.RunAll()
+		if err != nil {
+			panic(fmt.Sprintf("%+v", err))
+		}
+		costs = append(costs, g.losses.Value().Data().([]float32)[:count]...)
+		if learn {
+			err = a.optimizer.Update(g.learnables)
+			if err != nil {
+				panic(fmt.Sprintf("%+v", err))
+			}
+		}
+		g.machine.Reset()
+	}
+	return costs
+}
+
+// Profile computes the surprise of each byte of the input, the first byte
+// isn't predicted and has no surprise
+func (a *Attention) Profile(input []byte) []float32 {
+	profile := make([]float32, len(input))
+	if len(input) > 1 {
+		copy(profile[1:], a.costs(input, false))
+	}
+	return profile
+}
+
+// Score computes the surprise without learning
+func (a *Attention) Score(input []byte) (surprise, uncertainty float32) {
+	for _, cost := range a.costs(input, false) {
+		surprise += cost
+	}
+	return surprise / float32(len(input)), 0
+}
+
+// Train computes the surprise of the input and learns from it
+func (a *Attention) Train(input []byte) (surprise, uncertainty float32) {
+	for _, cost := range a.costs(input, true) {
+		surprise += cost
+	}
+	return surprise / float32(len(input)), 0
+}
+
+// attentionJSON is the JSON form of an attention model
+type attentionJSON struct {
+	Weights   map[string][]float32 `json:"weights"`
+	Optimizer *rnn.Optimizer       `json:"optimizer"`
+}
+
+// MarshalJSON encodes the weights and the optimizer of the model as JSON
+func (a *Attention) MarshalJSON() ([]byte, error) {
+	return json.Marshal(attentionJSON{
+		Weights:   rnn.Weights(a.learner.learnables),
+		Optimizer: a.optimizer,
+	})
+}
+
+// UnmarshalJSON decodes the weights and the optimizer of the model from JSON,
+// the weights must have the sizes of the model
+func (a *Attention) UnmarshalJSON(data []byte) error {
+	var snapshot attentionJSON
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return err
+	}
+	if snapshot.Optimizer == nil {
+		return errors.New("attention model has no optimizer")
+	}
+	if err = snapshot.Optimizer.Check(a.learner.learnables); err != nil {
+		return err
+	}
+	if err = rnn.SetWeights(a.learner.learnables, snapshot.Weights); err != nil {
+		return err
+	}
+	a.optimizer = snapshot.Optimizer
+	return nil
+}
@@ -0,0 +1,97 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package attention
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+var inputs = []string{
+	`{"name":"alice","age":31,"tags":["a","b"]}`,
+	`{"name":"bob","age":42,"tags":["c"]}`,
+	`{"name":"carol","age":27,"tags":[]}`,
+}
+
+// TestCausal checks that the cost of a byte doesn't depend on the bytes after
+// it
+func TestCausal(t *testing.T) {
+	options := DefaultOptions()
+	options.Window = 8
+	a := NewAttentionWithOptions(rand.New(rand.NewSource(1)), options)
+	input := []byte(inputs[0])
+	profile := a.Profile(input)
+	for _, length := range []int{2, 5, 8, 9, 13} {
+		for i, v := range a.Profile(input[:length]) {
+			if math.Abs(float64(v-profile[i])) > 1e-5 {
+				t.Fatalf("cost %d of a prefix of %d bytes is %v, expected %v", i, length, v, profile[i])
+			}
+		}
+	}
+}
+
+// TestLearn checks that the surprise decreases when learning
+func TestLearn(t *testing.T) {
+	a := NewAttention(rand.New(rand.NewSource(1)))
+	before, _ := a.Score([]byte(inputs[0]))
+	for i := 0; i < 30; i++ {
+		a.Train([]byte(inputs[i%len(inputs)]))
+	}
+	after, _ := a.Score([]byte(inputs[0]))
+	if after >= before || math.IsNaN(float64(after)) {
+		t.Errorf("surprise didn't decrease from %v to %v", before, after)
+	}
+}
+
+// TestSoftmax checks that the softmax and log softmax of large values are
+// finite
+func TestSoftmax(t *testing.T) {
+	g := G.NewGraph()
+	x := G.NewMatrix(g, tensor.Float32, G.WithName("x"), G.WithShape(2, 3),
+		G.WithValue(tensor.New(tensor.WithShape(2, 3), tensor.WithBacking([]float32{1000, 0, -1000, 1, 1, 1}))))
+	y, logY := softmax(x), logSoftmax(x)
+	machine := G.NewTapeMachine(g)
+	if err := machine.RunAll(); err != nil {
+		t.Fatal(err)
+	}
+	third := float32(1.0 / 3)
+	expected := []float32{1, 0, 0, third, third, third}
+	for i, v := range y.Value().Data().([]float32) {
+		if math.Abs(float64(v-expected[i])) > 1e-6 {
+			t.Errorf("softmax %d is %v, expected %v", i, v, expected[i])
+		}
+	}
+	logThird := float32(math.Log(1.0 / 3))
+	expected = []float32{0, -1000, -2000, logThird, logThird, logThird}
+	for i, v := range logY.Value().Data().([]float32) {
+		if math.Abs(float64(v-expected[i])) > 1e-4 {
+			t.Errorf("log softmax %d is %v, expected %v", i, v, expected[i])
+		}
+	}
+}
+
+// TestValidate checks that sizes below 1 aren't valid
+func TestValidate(t *testing.T) {
+	defaults := DefaultOptions()
+	if err := defaults.Validate(); err != nil {
+		t.Fatal(err)
+	}
+	for _, change := range []func(o *Options){
+		func(o *Options) { o.Window = 0 },
+		func(o *Options) { o.Size = -1 },
+		func(o *Options) { o.Layers = 0 },
+		func(o *Options) { o.Hidden = 0 },
+	} {
+		options := DefaultOptions()
+		change(&options)
+		if err := options.Validate(); err != ErrSizes {
+			t.Errorf("options %+v aren't an error", options)
+		}
+	}
+}
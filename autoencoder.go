@@ -7,35 +7,127 @@ package anomaly
 // Autoencoder is a autoencoding neural network
 import (
 	"encoding/json"
+	"errors"
 	"math"
 	"math/rand"
 
 	"github.com/pointlander/neural"
 )
 
+// AutoencoderOptions are the hyperparameters of an autoencoder
+type AutoencoderOptions struct {
+	// Hidden are the sizes of the hidden layers between the input and the
+	// bottleneck, the decoder mirrors them
+	Hidden []int
+	// Bottleneck is the size of the code layer, 0 is half the width of the
+	// vectors
+	Bottleneck int
+	// Dropout is the probability of dropping each entry of a vector when
+	// training
+	Dropout float64
+	// Noise is the standard deviation of the Gaussian noise added to each
+	// entry of a vector when training
+	Noise float64
+	// Replay is the number of previous vectors kept for replay, 0 disables
+	// replay
+	Replay int
+	// Batch is the number of replayed vectors learned with each new vector
+	Batch int
+	// LearnRate is the step size of gradient descent
+	LearnRate float32
+	// Momentum is the fraction of the previous change of a weight added to
+	// its next change
+	Momentum float32
+}
+
+// DefaultAutoencoderOptions returns the default hyperparameters of an
+// autoencoder
+func DefaultAutoencoderOptions() AutoencoderOptions {
+	return AutoencoderOptions{
+		LearnRate: 0.6,
+		Momentum:  0.4,
+	}
+}
+
+// Validate checks the options
+func (o *AutoencoderOptions) Validate() error {
+	for _, size := range o.Hidden {
+		if size < 1 {
+			return errors.New("hidden sizes must be at least 1")
+		}
+	}
+	if o.Bottleneck < 0 || o.Replay < 0 || o.Batch < 0 {
+		return errors.New("bottleneck, replay and batch can't be negative")
+	}
+	if o.Dropout < 0 || o.Dropout >= 1 || o.Noise < 0 {
+		return errors.New("dropout must be at least 0 and below 1 and noise can't be negative")
+	}
+	return nil
+}
+
 // Autoencoder is an autoencoding neural network
 type Autoencoder struct {
 	*neural.Neural32
 	*Vectorizer
+	AutoencoderOptions
+	replay [][]float32
+	seen   int
+	rnd    *rand.Rand
 }
 
 // NewAutoencoder creates an autoencoder
 func NewAutoencoder(rnd *rand.Rand, vectorizer *Vectorizer) Network {
-	width := vectorizer.Size
-	config := func(n *neural.Neural32) {
-		random32 := func(a, b float32) float32 {
-			return (b-a)*rnd.Float32() + a
+	return NewAutoencoderFactory(DefaultAutoencoderOptions())(rnd, vectorizer)
+}
+
+// NewAutoencoderFactory creates a factory for autoencoders with the given
+// hyperparameters, it panics if the options aren't valid
+func NewAutoencoderFactory(options AutoencoderOptions) NetworkFactory {
+	if err := options.Validate(); err != nil {
+		panic(err)
+	}
+	return func(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+		width, bottleneck := vectorizer.Size, options.Bottleneck
+		if bottleneck == 0 {
+			bottleneck = width / 2
+		}
+		layers := append([]int{width}, options.Hidden...)
+		layers = append(layers, bottleneck)
+		for i := len(options.Hidden) - 1; i >= 0; i-- {
+			layers = append(layers, options.Hidden[i])
+		}
+		layers = append(layers, width)
+
+		config := func(n *neural.Neural32) {
+			random32 := func(a, b float32) float32 {
+				return (b-a)*rnd.Float32() + a
+			}
+			weightInitializer := func(in, out int) float32 {
+				return random32(-1, 1) / float32(math.Sqrt(float64(in)))
+			}
+			n.Init(weightInitializer, layers...)
 		}
-		weightInitializer := func(in, out int) float32 {
-			return random32(-1, 1) / float32(math.Sqrt(float64(in)))
+		nn := neural.NewNeural32(config)
+		return &Autoencoder{
+			Neural32:           nn,
+			Vectorizer:         vectorizer,
+			AutoencoderOptions: options,
+			rnd:                rnd,
 		}
-		n.Init(weightInitializer, width, width/2, width)
 	}
-	nn := neural.NewNeural32(config)
-	return &Autoencoder{
-		Neural32:   nn,
-		Vectorizer: vectorizer,
+}
+
+// ScoreVector computes the reconstruction error of a unit vector
+func (a *Autoencoder) ScoreVector(unit []float32) float32 {
+	input, context := Adapt(unit), a.NewContext()
+	context.SetInput(input)
+	context.Infer()
+	sum := float32(0)
+	for i, output := range context.GetOutput() {
+		d := input[i] - output
+		sum += d * d
 	}
+	return sum / float32(len(input))
 }
 
 // Train calculates the surprise with the autoencoder
@@ -46,14 +138,83 @@ func (a *Autoencoder) Train(input []byte) (surprise, uncertainty float32) {
 		panic(err)
 	}
 	vector := a.Vectorizer.Vectorize(object)
-	unit := Normalize(vector)
+	return a.TrainVector(Normalize(vector)), 0
+}
 
-	unit = Adapt(unit)
-	source := func(iterations int) [][][]float32 {
-		data := make([][][]float32, 1)
-		data[0] = [][]float32{unit, unit}
-		return data
+// TrainErrors trains the autoencoder on a JSON document and returns the
+// reconstruction errors of its vector before and after training
+func (a *Autoencoder) TrainErrors(input []byte) (before, after float32) {
+	var object map[string]interface{}
+	err := json.Unmarshal(input, &object)
+	if err != nil {
+		panic(err)
+	}
+	vector := a.Vectorizer.Vectorize(object)
+	return a.TrainVectorErrors(Normalize(vector))
+}
+
+// TrainVector trains the autoencoder on a unit vector and returns the
+// training error of the vector
+func (a *Autoencoder) TrainVector(unit []float32) float32 {
+	return a.learn(unit)
+}
+
+// TrainVectorErrors trains the autoencoder on a unit vector and returns its
+// reconstruction errors before and after training
+func (a *Autoencoder) TrainVectorErrors(unit []float32) (before, after float32) {
+	before = a.ScoreVector(unit)
+	a.learn(unit)
+	return before, a.ScoreVector(unit)
+}
+
+// corrupt drops entries of a unit vector and adds noise to them
+func (a *Autoencoder) corrupt(unit []float32) []float32 {
+	if a.Dropout == 0 && a.Noise == 0 {
+		return unit
+	}
+	corrupted := make([]float32, len(unit))
+	for i, v := range unit {
+		if a.Dropout > 0 && a.rnd.Float64() < a.Dropout {
+			continue
+		}
+		corrupted[i] = v
+		if a.Noise > 0 {
+			corrupted[i] += float32(a.rnd.NormFloat64() * a.Noise)
+		}
+	}
+	return corrupted
+}
+
+// learn trains the autoencoder to reconstruct a unit vector and then the
+// replayed vectors from corrupted copies, it returns the training error of the
+// unit vector
+func (a *Autoencoder) learn(unit []float32) float32 {
+	train := func(vectors ...[]float32) float32 {
+		source := func(iterations int) [][][]float32 {
+			data := make([][][]float32, len(vectors))
+			for i, vector := range vectors {
+				data[i] = [][]float32{Adapt(a.corrupt(vector)), Adapt(vector)}
+			}
+			return data
+		}
+		return a.Neural32.Train(source, 1, a.LearnRate, a.Momentum)[0]
+	}
+	e := train(unit)
+	if len(a.replay) > 0 && a.Batch > 0 {
+		vectors := make([][]float32, a.Batch)
+		for i := range vectors {
+			vectors[i] = a.replay[a.rnd.Intn(len(a.replay))]
+		}
+		train(vectors...)
+	}
+
+	if a.Replay > 0 {
+		if len(a.replay) < a.Replay {
+			a.replay = append(a.replay, unit)
+		} else {
+			a.replay[a.seen%a.Replay] = unit
+		}
+		a.seen++
 	}
-	e := a.Neural32.Train(source, 1, 0.6, 0.4)
-	return e[0], 0
+	return e
 }
@@ -6,8 +6,10 @@ package anomaly
 
 import (
 	"encoding/json"
+	"errors"
 	"math"
 	"math/rand"
+	"sort"
 )
 
 const vectorsSize = 1024
@@ -16,6 +18,7 @@ const vectorsSize = 1024
 // similarity across all Vectors
 type AverageSimilarity struct {
 	vectors       [][]float32
+	documents     [][]byte
 	begin, length int
 	*Vectorizer
 }
@@ -28,6 +31,30 @@ func NewAverageSimilarity(rnd *rand.Rand, vectorizer *Vectorizer) Network {
 	}
 }
 
+// NewAverageSimilarityWithExemplars creates a new average similarity surprise
+// engine that also keeps the documents of its vectors as exemplars
+func NewAverageSimilarityWithExemplars(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+	return &AverageSimilarity{
+		vectors:    make([][]float32, vectorsSize),
+		documents:  make([][]byte, vectorsSize),
+		Vectorizer: vectorizer,
+	}
+}
+
+// ScoreVector computes the average similarity of a unit vector, it is 0
+// until there are vectors
+func (a *AverageSimilarity) ScoreVector(unit []float32) float32 {
+	if a.length == 0 {
+		return 0
+	}
+	sum, c := 0.0, a.begin
+	for i := 0; i < a.length; i++ {
+		sum += math.Abs(Similarity(unit, a.vectors[c]))
+		c = (c + 1) % vectorsSize
+	}
+	return float32(sum / float64(a.length))
+}
+
 // Train computes the surprise with average similarity
 func (a *AverageSimilarity) Train(input []byte) (surprise, uncertainty float32) {
 	var object map[string]interface{}
@@ -38,20 +65,92 @@ func (a *AverageSimilarity) Train(input []byte) (surprise, uncertainty float32)
 	vector := a.Vectorizer.Vectorize(object)
 	unit := Normalize(vector)
 
-	sum, c := 0.0, a.begin
-	for i := 0; i < a.length; i++ {
-		sum += math.Abs(Similarity(unit, a.vectors[c]))
-		c = (c + 1) % vectorsSize
+	averageSimilarity := a.TrainVector(unit)
+	if a.documents != nil {
+		a.documents[(a.begin+a.length-1)%vectorsSize] = append([]byte(nil), input...)
 	}
-	averageSimilarity := float32(sum / float64(a.length))
 
+	return averageSimilarity, 0
+}
+
+// TrainVector computes the average similarity of a unit vector and adds it
+// to the vectors
+func (a *AverageSimilarity) TrainVector(unit []float32) float32 {
+	averageSimilarity := a.ScoreVector(unit)
+
+	c := a.begin
 	if a.length < vectorsSize {
-		a.vectors[a.begin+a.length] = unit
+		c += a.length
 		a.length++
 	} else {
-		a.vectors[a.begin] = unit
 		a.begin = (a.begin + 1) % vectorsSize
 	}
+	a.vectors[c] = unit
 
-	return averageSimilarity, 0
+	return averageSimilarity
+}
+
+// Exemplar is a previously seen document and its similarity to a query
+type Exemplar struct {
+	Document []byte
+	// Similarity is the magnitude of the cosine similarity, the measure
+	// ScoreVector averages
+	Similarity float64
+}
+
+// Neighbors are the previously seen documents most similar to a query
+type Neighbors struct {
+	Exemplars []Exemplar
+	// Diff is the structural difference from the most similar exemplar to
+	// the query, fields only in the query are added
+	Diff []Difference
+}
+
+// ErrNoExemplars is returned when exemplars aren't kept
+var ErrNoExemplars = errors.New("exemplars aren't kept")
+
+// ErrNegativeK is returned when the number of neighbors is negative
+var ErrNegativeK = errors.New("number of neighbors is negative")
+
+// Nearest finds the k previously seen documents most similar to a query
+// without learning
+func (a *AverageSimilarity) Nearest(input []byte, k int) (*Neighbors, error) {
+	if a.documents == nil {
+		return nil, ErrNoExemplars
+	}
+	if k < 0 {
+		return nil, ErrNegativeK
+	}
+	var object map[string]interface{}
+	err := json.Unmarshal(input, &object)
+	if err != nil {
+		return nil, err
+	}
+	unit := Normalize(a.Vectorizer.Vectorize(object))
+
+	exemplars, c := make([]Exemplar, a.length), a.begin
+	for i := range exemplars {
+		exemplars[i] = Exemplar{
+			Document:   a.documents[c],
+			Similarity: math.Abs(Similarity(unit, a.vectors[c])),
+		}
+		c = (c + 1) % vectorsSize
+	}
+	sort.SliceStable(exemplars, func(i, j int) bool {
+		return exemplars[i].Similarity > exemplars[j].Similarity
+	})
+	if k < len(exemplars) {
+		exemplars = exemplars[:k]
+	}
+
+	neighbors := &Neighbors{
+		Exemplars: exemplars,
+	}
+	if len(exemplars) > 0 {
+		neighbors.Diff, err = Diff(exemplars[0].Document, input)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return neighbors, nil
 }
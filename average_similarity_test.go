@@ -0,0 +1,82 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// TestNearest checks the exemplars most similar to a document
+func TestNearest(t *testing.T) {
+	vectorizer := NewVectorizer(1024, true, NewLFSR32Source)
+	documents := []string{
+		`{"user":"alice","action":"login"}`,
+		`{"user":"bob","action":"logout"}`,
+		`{"user":"alice","action":"logout"}`,
+	}
+	similarity := NewAverageSimilarityWithExemplars(nil, vectorizer).(*AverageSimilarity)
+	for _, document := range documents {
+		similarity.Train([]byte(document))
+	}
+	unit := func(document string) []float32 {
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(document), &object); err != nil {
+			t.Fatal(err)
+		}
+		return Normalize(vectorizer.Vectorize(object))
+	}
+
+	tests := []struct {
+		query     string
+		k         int
+		exemplars []string
+		diff      []string
+	}{
+		{`{"user":"alice","action":"login"}`, 1, documents[:1], nil},
+		{`{"user":"bob","action":"login"}`, 0, nil, nil},
+		{`{"user":"bob","action":"logout"}`, 2, []string{documents[1], documents[2]}, nil},
+		{`{"user":"alice","action":"login","ok":true}`, 5, []string{documents[0], documents[2], documents[1]},
+			[]string{"$.ok: added true"}},
+	}
+	for _, test := range tests {
+		neighbors, err := similarity.Nearest([]byte(test.query), test.k)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(neighbors.Exemplars) != len(test.exemplars) {
+			t.Fatalf("%s: %d exemplars, expected %d", test.query, len(neighbors.Exemplars), len(test.exemplars))
+		}
+		for i, exemplar := range neighbors.Exemplars {
+			if string(exemplar.Document) != test.exemplars[i] {
+				t.Errorf("%s: exemplar %d is %s, expected %s", test.query, i, exemplar.Document, test.exemplars[i])
+			}
+			// an exemplar has the similarity the engine averages
+			single := NewAverageSimilarity(nil, vectorizer).(*AverageSimilarity)
+			single.Train(exemplar.Document)
+			expected := float64(single.ScoreVector(unit(test.query)))
+			if math.Abs(exemplar.Similarity-expected) > 1e-6 {
+				t.Errorf("%s: similarity of %s is %v, expected %v", test.query, exemplar.Document,
+					exemplar.Similarity, expected)
+			}
+		}
+		var diff []string
+		for _, difference := range neighbors.Diff {
+			diff = append(diff, difference.String())
+		}
+		if len(diff) != len(test.diff) || len(diff) > 0 && diff[0] != test.diff[0] {
+			t.Errorf("%s: diff is %q, expected %q", test.query, diff, test.diff)
+		}
+	}
+
+	if _, err := similarity.Nearest([]byte(`{}`), -1); err != ErrNegativeK {
+		t.Errorf("error is %v, expected %v", err, ErrNegativeK)
+	}
+	without := NewAverageSimilarity(nil, vectorizer).(*AverageSimilarity)
+	if _, err := without.Nearest([]byte(`{}`), 1); err != ErrNoExemplars {
+		t.Errorf("error is %v, expected %v", err, ErrNoExemplars)
+	}
+}
@@ -0,0 +1,231 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/pointlander/anomaly"
+)
+
+var engine = flag.String("engine", "complexity", "engine for scoring: "+strings.Join(anomaly.Engines(), ", "))
+var options = flag.String("options", "", "JSON hyperparameters of the engine")
+var seed = flag.Int64("seed", 1, "seed of the random number generator")
+var input = flag.String("input", "json", "format of the input: json for a JSON document per line or lines for raw lines")
+var output = flag.String("output", "jsonl", "format of the output: jsonl or csv")
+var load = flag.String("load", "", "load the model from this file instead of creating one from the engine and options")
+var save = flag.String("save", "", "save the model to this file")
+var learn = flag.Bool("learn", true, "learn from the input, otherwise only score it")
+var threshold = flag.Float64("threshold", anomaly.DefaultThreshold, "magnitude of the z-score of an alert, 0 disables alerts")
+
+// Record is an input annotated with its surprise
+type Record struct {
+	File     string          `json:"file,omitempty"`
+	Line     int             `json:"line"`
+	Document json.RawMessage `json:"document,omitempty"`
+	Text     string          `json:"text,omitempty"`
+	anomaly.Result
+}
+
+// Writer writes records
+type Writer interface {
+	Write(record *Record) error
+	Flush() error
+}
+
+// JSONWriter writes records as a JSON object per line
+type JSONWriter struct {
+	*bufio.Writer
+	encoder *json.Encoder
+}
+
+// NewJSONWriter creates a new JSONWriter
+func NewJSONWriter(w io.Writer) *JSONWriter {
+	buffered := bufio.NewWriter(w)
+	return &JSONWriter{
+		Writer:  buffered,
+		encoder: json.NewEncoder(buffered),
+	}
+}
+
+// Write writes a record
+func (j *JSONWriter) Write(record *Record) error {
+	return j.encoder.Encode(record)
+}
+
+// CSVWriter writes records as CSV with a header
+type CSVWriter struct {
+	*csv.Writer
+	header bool
+}
+
+// NewCSVWriter creates a new CSVWriter
+func NewCSVWriter(w io.Writer) *CSVWriter {
+	return &CSVWriter{
+		Writer: csv.NewWriter(w),
+	}
+}
+
+// Write writes a record
+func (c *CSVWriter) Write(record *Record) error {
+	if !c.header {
+		err := c.Writer.Write([]string{"file", "line", "surprise", "uncertainty", "zscore", "alert", "input"})
+		if err != nil {
+			return err
+		}
+		c.header = true
+	}
+	text := record.Text
+	if record.Document != nil {
+		text = string(record.Document)
+	}
+	return c.Writer.Write([]string{
+		record.File,
+		strconv.Itoa(record.Line),
+		strconv.FormatFloat(float64(record.Surprise), 'g', -1, 32),
+		strconv.FormatFloat(float64(record.Uncertainty), 'g', -1, 32),
+		strconv.FormatFloat(record.ZScore, 'g', -1, 64),
+		strconv.FormatBool(record.Alert),
+		text,
+	})
+}
+
+// Flush flushes the records
+func (c *CSVWriter) Flush() error {
+	c.Writer.Flush()
+	return c.Writer.Error()
+}
+
+// process scores each line of a reader and writes the records
+func process(detector *anomaly.Detector, name string, reader io.Reader, writer Writer) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 64*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := bytes.TrimSpace(scanner.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		record := &Record{
+			File: name,
+			Line: line,
+		}
+		if *input == "json" {
+			if !json.Valid(text) {
+				log.Printf("%s:%d: invalid JSON", name, line)
+				continue
+			}
+			record.Document = append(json.RawMessage(nil), text...)
+		} else {
+			record.Text = string(text)
+		}
+
+		var err error
+		if *learn {
+			record.Result, err = detector.Train(text)
+		} else {
+			record.Result, err = detector.Score(text)
+		}
+		if err == anomaly.ErrNotScorer {
+			return err
+		} else if err != nil {
+			log.Printf("%s:%d: %v", name, line, err)
+			continue
+		}
+		err = writer.Write(record)
+		if _, ok := err.(*json.UnsupportedValueError); ok {
+			// a result such as NaN can't be written as JSON
+			log.Printf("%s:%d: %v", name, line, err)
+			continue
+		} else if err != nil {
+			return err
+		}
+	}
+	return scanner.Err()
+}
+
+func main() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [files]\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Scores each line of the files or of standard input")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if *input != "json" && *input != "lines" {
+		log.Fatalf("unknown input format %q", *input)
+	}
+
+	var writer Writer
+	switch *output {
+	case "jsonl":
+		writer = NewJSONWriter(os.Stdout)
+	case "csv":
+		writer = NewCSVWriter(os.Stdout)
+	default:
+		log.Fatalf("unknown output format %q", *output)
+	}
+
+	var detector *anomaly.Detector
+	var err error
+	if *load != "" {
+		detector, err = anomaly.LoadDetector(*load)
+	} else {
+		detector, err = anomaly.NewDetector(*engine, json.RawMessage(*options), *seed)
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+	// a loaded model keeps its threshold unless one is given
+	flag.Visit(func(f *flag.Flag) {
+		if f.Name == "threshold" {
+			detector.Threshold = *threshold
+		}
+	})
+	if *save != "" {
+		if _, ok := detector.Network.(anomaly.Persistent); !ok {
+			log.Fatalf("engine %q: %v", detector.Engine, anomaly.ErrNotPersistent)
+		}
+	}
+
+	if flag.NArg() == 0 {
+		err = process(detector, "", os.Stdin, writer)
+	}
+	for _, name := range flag.Args() {
+		if err != nil {
+			break
+		}
+		var file *os.File
+		file, err = os.Open(name)
+		if err != nil {
+			break
+		}
+		err = process(detector, name, file, writer)
+		file.Close()
+	}
+	if flushErr := writer.Flush(); err == nil {
+		err = flushErr
+	}
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	if *save != "" {
+		err = detector.Save(*save)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+}
@@ -17,6 +17,10 @@ import (
 	"gonum.org/v1/plot/vg"
 
 	"github.com/pointlander/anomaly"
+	"github.com/pointlander/anomaly/attention"
+	"github.com/pointlander/anomaly/gru"
+	"github.com/pointlander/anomaly/lstm"
+	"github.com/pointlander/anomaly/rnn"
 )
 
 const (
@@ -32,6 +36,9 @@ const (
 	Cutoff = 100
 )
 
+// Documents is the number of random JSON objects in each generated document
+var Documents = 1
+
 // Tests are basic tests for anomaly detection
 var Tests = []string{`{
  "alfa": [
@@ -101,7 +108,14 @@ func Anomaly(seed int, factory anomaly.NetworkFactory, name string) *TestResults
 	surprise, uncertainty := make(plotter.Values, Samples), make(plotter.Values, Samples)
 	hasUncertainty := false
 	for i := 0; i < Samples; i++ {
-		object := anomaly.GenerateRandomJSON(rndGenerator)
+		var object interface{} = anomaly.GenerateRandomJSON(rndGenerator)
+		if Documents > 1 {
+			objects := make([]interface{}, Documents)
+			for j := range objects {
+				objects[j] = anomaly.GenerateRandomJSON(rndGenerator)
+			}
+			object = objects
+		}
 		input, err := json.Marshal(object)
 		if err != nil {
 			panic(err)
@@ -168,10 +182,86 @@ func (t *TestResults) Print() {
 }
 
 var full = flag.Bool("full", false, "run full bench")
+var sweep = flag.Bool("sweep", false, "sweep the hyperparameters of the recurrent networks")
+var long = flag.Int("long", 0, "compare the sequence networks on documents of this many random JSON objects")
+
+// Sweep runs the recurrent networks with different hyperparameters
+func Sweep() {
+	solvers := []struct {
+		name       string
+		lstmSolver lstm.Solver
+		gruSolver  gru.Solver
+	}{
+		{"rmsprop", lstm.SolverRMSProp, gru.SolverRMSProp},
+		{"adam", lstm.SolverAdam, gru.SolverAdam},
+		{"momentum", lstm.SolverMomentum, gru.SolverMomentum},
+	}
+	trainings := []struct {
+		name     string
+		steps    int
+		stateful bool
+	}{
+		{"sliding", 4, false},
+		{"stateful", 16, true},
+	}
+	for _, training := range trainings {
+		for _, hiddenSize := range []int{10, 32} {
+			for _, learnRate := range []float64{0.001, 0.01, 0.1} {
+				for _, solver := range solvers {
+					name := fmt.Sprintf("training=%v hidden=%v learnrate=%v solver=%v",
+						training.name, hiddenSize, learnRate, solver.name)
+
+					lstmOptions := lstm.DefaultOptions()
+					lstmOptions.Steps = training.steps
+					lstmOptions.Stateful = training.stateful
+					lstmOptions.HiddenSizes = []int{hiddenSize}
+					lstmOptions.LearnRate = learnRate
+					lstmOptions.Solver = solver.lstmSolver
+					Anomaly(1, anomaly.NewLSTMFactory(lstmOptions), "lstm "+name).Print()
+
+					gruOptions := gru.DefaultOptions()
+					gruOptions.Steps = training.steps
+					gruOptions.Stateful = training.stateful
+					gruOptions.HiddenSizes = []int{hiddenSize}
+					gruOptions.LearnRate = learnRate
+					gruOptions.Solver = solver.gruSolver
+					Anomaly(1, anomaly.NewGRUFactory(gruOptions), "gru "+name).Print()
+				}
+			}
+		}
+	}
+}
+
+// Long runs the sequence networks on long JSON documents
+func Long(objects int) {
+	Documents = objects
+	name := fmt.Sprintf(" objects=%v", objects)
+	Anomaly(1, anomaly.NewLSTM, "lstm"+name).Print()
+	Anomaly(1, anomaly.NewGRU, "gru"+name).Print()
+	Anomaly(1, anomaly.NewAttention, "attention"+name).Print()
+	Anomaly(1, anomaly.NewBidirectionalFactory(rnn.LSTM{}, rnn.DefaultBidirectionalOptions()),
+		"bidirectional lstm"+name).Print()
+	for _, window := range []int{64, 128} {
+		options := attention.DefaultOptions()
+		options.Window = window
+		Anomaly(1, anomaly.NewAttentionFactory(options),
+			fmt.Sprintf("attention window=%v%v", window, name)).Print()
+	}
+}
 
 func main() {
 	flag.Parse()
 
+	if *sweep {
+		Sweep()
+		return
+	}
+
+	if *long > 0 {
+		Long(*long)
+		return
+	}
+
 	graph := 1
 
 	histogram := func(title, name string, values *TestResults) {
@@ -277,6 +367,13 @@ func main() {
 		averageSimilarity, neuron)
 	neuron.Print()
 
+	neuronOptions := anomaly.DefaultNeuronOptions()
+	neuronOptions.Prototypes = 4
+	prototypes := Anomaly(1, anomaly.NewNeuronFactory(neuronOptions), "prototype neurons")
+	histogram("Prototype Neurons Distribution", "prototype_neurons_distribution.png", prototypes)
+	scatterPlot("Neuron", "Prototype Neurons", "prototype_neurons_vs_neuron.png", neuron, prototypes)
+	prototypes.Print()
+
 	autoencoderError := Anomaly(1, anomaly.NewAutoencoder, "autoencoder")
 	histogram("Autoencoder Error Distribution", "autoencoder_error_distribution.png", autoencoderError)
 	scatterPlot("Time", "Autoencoder Error", "autoencoder_error.png", nil, autoencoderError)
@@ -284,6 +381,21 @@ func main() {
 		averageSimilarity, autoencoderError)
 	autoencoderError.Print()
 
+	autoencoderOptions := anomaly.DefaultAutoencoderOptions()
+	autoencoderOptions.Hidden, autoencoderOptions.Bottleneck = []int{256}, 64
+	autoencoderOptions.Dropout, autoencoderOptions.Replay, autoencoderOptions.Batch = 0.1, 64, 4
+	denoisingError := Anomaly(1, anomaly.NewAutoencoderFactory(autoencoderOptions), "denoising autoencoder")
+	histogram("Denoising Autoencoder Error Distribution", "denoising_autoencoder_error_distribution.png", denoisingError)
+	scatterPlot("Autoencoder Error", "Denoising Autoencoder Error", "denoising_autoencoder_error_vs_autoencoder_error.png",
+		autoencoderError, denoisingError)
+	denoisingError.Print()
+
+	vae := Anomaly(1, anomaly.NewVAE, "vae")
+	histogram("VAE Distribution", "vae_distribution.png", vae)
+	scatterPlot("Time", "VAE", "vae.png", nil, vae)
+	scatterPlot("Autoencoder Error", "VAE", "vae_vs_autoencoder_error.png", autoencoderError, vae)
+	vae.Print()
+
 	lstmError := Anomaly(1, anomaly.NewLSTM, "lstm")
 	histogram("LSTM Distribution", "lstm_distribution.png", lstmError)
 	scatterPlot("Time", "LSTM", "lstm.png", nil, lstmError)
@@ -297,6 +409,18 @@ func main() {
 	scatterPlot("GRU", "LSTM", "lstm_vs_gru.png", gruError, lstmError)
 	gruError.Print()
 
+	attentionError := Anomaly(1, anomaly.NewAttention, "attention")
+	histogram("Attention Distribution", "attention_distribution.png", attentionError)
+	scatterPlot("Time", "Attention", "attention.png", nil, attentionError)
+	scatterPlot("Attention", "LSTM", "lstm_vs_attention.png", attentionError, lstmError)
+	attentionError.Print()
+
+	bidirectional := Anomaly(1, anomaly.NewBidirectionalFactory(rnn.LSTM{}, rnn.DefaultBidirectionalOptions()), "bidirectional lstm")
+	histogram("Bidirectional LSTM Distribution", "bidirectional_lstm_distribution.png", bidirectional)
+	scatterPlot("Time", "Bidirectional LSTM", "bidirectional_lstm.png", nil, bidirectional)
+	scatterPlot("Bidirectional LSTM", "LSTM", "lstm_vs_bidirectional_lstm.png", bidirectional, lstmError)
+	bidirectional.Print()
+
 	complexityError := Anomaly(1, anomaly.NewComplexity, "complexity")
 	histogram("Complexity Distribution", "complexity_distribution.png", complexityError)
 	scatterPlot("Time", "Complexity", "complexity.png", nil, complexityError)
@@ -306,6 +430,25 @@ func main() {
 	scatterPlot("Time", "Meta", "meta.png", nil, metaError)
 	metaError.Print()
 
+	lof := Anomaly(1, anomaly.NewLOF, "lof")
+	histogram("LOF Distribution", "lof_distribution.png", lof)
+	scatterPlot("Time", "LOF", "lof.png", nil, lof)
+	scatterPlot("Average Similarity", "LOF", "lof_vs_average_similarity.png",
+		averageSimilarity, lof)
+	lof.Print()
+
+	novelty := Anomaly(1, anomaly.NewNovelty, "novelty")
+	scatterPlot("Time", "Novelty", "novelty.png", nil, novelty)
+	novelty.Print()
+
+	embedding := Anomaly(1, anomaly.NewRecurrentEmbeddingFactory(rnn.LSTM{}, rnn.DefaultOptions(),
+		rnn.PoolingMean, anomaly.NewAverageSimilarity), "lstm embedding")
+	histogram("LSTM Embedding Distribution", "lstm_embedding_distribution.png", embedding)
+	scatterPlot("Time", "LSTM Embedding", "lstm_embedding.png", nil, embedding)
+	scatterPlot("Average Similarity", "LSTM Embedding", "lstm_embedding_vs_average_similarity.png",
+		averageSimilarity, embedding)
+	embedding.Print()
+
 	if !*full {
 		return
 	}
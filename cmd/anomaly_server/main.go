@@ -0,0 +1,453 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"log"
+	"math"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/pointlander/anomaly"
+)
+
+var listen = flag.String("listen", ":8080", "address to listen on")
+var limit = flag.Int64("limit", 16<<20, "maximum size of a request body in bytes")
+
+// Model is a detector that is shared between requests
+type Model struct {
+	sync.Mutex
+	Name string
+	*anomaly.Detector
+}
+
+// Info describes a model and the statistics of its surprise
+type Info struct {
+	Name      string          `json:"name"`
+	Engine    string          `json:"engine"`
+	Options   json.RawMessage `json:"options,omitempty"`
+	Seed      int64           `json:"seed"`
+	Threshold float64         `json:"threshold"`
+	Count     int             `json:"count"`
+	Mean      float64         `json:"mean"`
+	Variance  float64         `json:"variance"`
+	Deviation float64         `json:"deviation"`
+}
+
+// Info describes the model, the model must be locked
+func (m *Model) Info() Info {
+	variance := m.Variance()
+	return Info{
+		Name:      m.Name,
+		Engine:    m.Engine,
+		Options:   m.Options,
+		Seed:      m.Seed,
+		Threshold: m.Threshold,
+		Count:     m.Count,
+		Mean:      m.Mean,
+		Variance:  variance,
+		Deviation: math.Sqrt(variance),
+	}
+}
+
+// Create is a request to create a model
+type Create struct {
+	Name    string          `json:"name"`
+	Engine  string          `json:"engine"`
+	Options json.RawMessage `json:"options,omitempty"`
+	Seed    int64           `json:"seed"`
+	// Threshold is the magnitude of the z-score of an alert, the default is
+	// used when it is missing
+	Threshold *float64 `json:"threshold,omitempty"`
+}
+
+// Outcome is the result for a document of a batch
+type Outcome struct {
+	*anomaly.Result
+	Error string `json:"error,omitempty"`
+}
+
+// Batch is the results for a batch of documents
+type Batch struct {
+	Results []Outcome `json:"results"`
+}
+
+// Error is an error response
+type Error struct {
+	Error string `json:"error"`
+}
+
+// Server serves the models
+type Server struct {
+	sync.RWMutex
+	Models map[string]*Model
+
+	requestsMutex sync.Mutex
+	requests      map[request]uint64
+}
+
+// NewServer creates a new server with no models
+func NewServer() *Server {
+	return &Server{
+		Models:   make(map[string]*Model),
+		requests: make(map[request]uint64),
+	}
+}
+
+// reply writes a JSON response. A value that can't be encoded is an internal
+// server error
+func reply(w http.ResponseWriter, status int, value interface{}) {
+	var buffer bytes.Buffer
+	err := json.NewEncoder(&buffer).Encode(value)
+	if err != nil {
+		log.Println(err)
+		buffer.Reset()
+		status = http.StatusInternalServerError
+		json.NewEncoder(&buffer).Encode(Error{Error: err.Error()})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	_, err = w.Write(buffer.Bytes())
+	if err != nil {
+		log.Println(err)
+	}
+}
+
+// fail writes an error response
+func fail(w http.ResponseWriter, status int, err error) {
+	reply(w, status, Error{Error: err.Error()})
+}
+
+// valid checks a model name
+func valid(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9' ||
+			r == '-' || r == '_' || r == '.') {
+			return false
+		}
+	}
+	return true
+}
+
+// model finds a model by name
+func (s *Server) model(name string) *Model {
+	s.RLock()
+	defer s.RUnlock()
+	return s.Models[name]
+}
+
+// add adds or replaces a model
+func (s *Server) add(model *Model, replace bool) bool {
+	s.Lock()
+	defer s.Unlock()
+	if _, ok := s.Models[model.Name]; ok && !replace {
+		return false
+	}
+	s.Models[model.Name] = model
+	return true
+}
+
+// ServeHTTP routes the requests
+//
+//	GET    /v1/engines                  the names of the engines
+//	GET    /v1/models                   the models
+//	POST   /v1/models                   create a model
+//	GET    /v1/models/{name}            the statistics of a model
+//	DELETE /v1/models/{name}            delete a model
+//	POST   /v1/models/{name}/score      score documents without learning
+//	POST   /v1/models/{name}/train      score documents and learn from them
+//	GET    /v1/models/{name}/snapshot   snapshot a model
+//	PUT    /v1/models/{name}/snapshot   restore a model from a snapshot
+//	GET    /metrics                     metrics in the Prometheus text format
+func (s *Server) ServeHTTP(writer http.ResponseWriter, r *http.Request) {
+	w := &recorder{ResponseWriter: writer, status: http.StatusOK}
+	r.Body = http.MaxBytesReader(w, r.Body, *limit)
+	parts := strings.Split(strings.Trim(r.URL.Path, "/"), "/")
+	defer func() {
+		s.count(request{route: route(parts), method: r.Method, status: w.status})
+	}()
+	if len(parts) == 1 && parts[0] == "metrics" {
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		s.metrics(w, r)
+		return
+	}
+	if len(parts) < 2 || parts[0] != "v1" {
+		fail(w, http.StatusNotFound, errors.New("not found"))
+		return
+	}
+	switch {
+	case len(parts) == 2 && parts[1] == "engines":
+		if r.Method != http.MethodGet {
+			w.Header().Set("Allow", http.MethodGet)
+			fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		reply(w, http.StatusOK, anomaly.Engines())
+	case len(parts) == 2 && parts[1] == "models":
+		switch r.Method {
+		case http.MethodGet:
+			s.list(w, r)
+		case http.MethodPost:
+			s.create(w, r)
+		default:
+			w.Header().Set("Allow", "GET, POST")
+			fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+	case len(parts) == 3 && parts[1] == "models":
+		switch r.Method {
+		case http.MethodGet:
+			s.info(w, r, parts[2])
+		case http.MethodDelete:
+			s.remove(w, r, parts[2])
+		default:
+			w.Header().Set("Allow", "GET, DELETE")
+			fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+	case len(parts) == 4 && parts[1] == "models" && (parts[3] == "score" || parts[3] == "train"):
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+			return
+		}
+		s.score(w, r, parts[2], parts[3] == "train")
+	case len(parts) == 4 && parts[1] == "models" && parts[3] == "snapshot":
+		switch r.Method {
+		case http.MethodGet:
+			s.snapshot(w, r, parts[2])
+		case http.MethodPut:
+			s.restore(w, r, parts[2])
+		default:
+			w.Header().Set("Allow", "GET, PUT")
+			fail(w, http.StatusMethodNotAllowed, errors.New("method not allowed"))
+		}
+	default:
+		fail(w, http.StatusNotFound, errors.New("not found"))
+	}
+}
+
+// list lists the models
+func (s *Server) list(w http.ResponseWriter, r *http.Request) {
+	s.RLock()
+	models := make([]*Model, 0, len(s.Models))
+	for _, model := range s.Models {
+		models = append(models, model)
+	}
+	s.RUnlock()
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].Name < models[j].Name
+	})
+	infos := make([]Info, len(models))
+	for i, model := range models {
+		model.Lock()
+		infos[i] = model.Info()
+		model.Unlock()
+	}
+	reply(w, http.StatusOK, infos)
+}
+
+// create creates a model from an engine and options
+func (s *Server) create(w http.ResponseWriter, r *http.Request) {
+	var request Create
+	err := json.NewDecoder(r.Body).Decode(&request)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	if !valid(request.Name) {
+		fail(w, http.StatusBadRequest, fmt.Errorf("invalid model name %q", request.Name))
+		return
+	}
+	detector, err := anomaly.NewDetector(request.Engine, request.Options, request.Seed)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	if request.Threshold != nil {
+		detector.Threshold = *request.Threshold
+	}
+	model := &Model{
+		Name:     request.Name,
+		Detector: detector,
+	}
+	info := model.Info()
+	if !s.add(model, false) {
+		fail(w, http.StatusConflict, fmt.Errorf("model %q exists", request.Name))
+		return
+	}
+	reply(w, http.StatusCreated, info)
+}
+
+// info writes the statistics of a model
+func (s *Server) info(w http.ResponseWriter, r *http.Request, name string) {
+	model := s.model(name)
+	if model == nil {
+		fail(w, http.StatusNotFound, fmt.Errorf("model %q not found", name))
+		return
+	}
+	model.Lock()
+	info := model.Info()
+	model.Unlock()
+	reply(w, http.StatusOK, info)
+}
+
+// remove deletes a model
+func (s *Server) remove(w http.ResponseWriter, r *http.Request, name string) {
+	s.Lock()
+	_, ok := s.Models[name]
+	delete(s.Models, name)
+	s.Unlock()
+	if !ok {
+		fail(w, http.StatusNotFound, fmt.Errorf("model %q not found", name))
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// input converts a document of a request into the input of a detector, JSON
+// strings are raw text and anything else is a JSON document
+func input(document json.RawMessage) []byte {
+	var text string
+	if json.Unmarshal(document, &text) == nil {
+		return []byte(text)
+	}
+	return document
+}
+
+// score scores a document or a JSON array of documents. The result of a
+// single document is returned directly and a batch returns a result or an
+// error for each of its documents
+func (s *Server) score(w http.ResponseWriter, r *http.Request, name string, learn bool) {
+	model := s.model(name)
+	if model == nil {
+		fail(w, http.StatusNotFound, fmt.Errorf("model %q not found", name))
+		return
+	}
+	body, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	body = bytes.TrimSpace(body)
+	if !json.Valid(body) {
+		fail(w, http.StatusBadRequest, errors.New("body isn't JSON"))
+		return
+	}
+
+	process := func(input []byte) (anomaly.Result, error) {
+		if learn {
+			return model.Train(input)
+		}
+		return model.Score(input)
+	}
+	if body[0] != '[' {
+		model.Lock()
+		result, err := process(input(body))
+		model.Unlock()
+		switch {
+		case err == anomaly.ErrNotScorer:
+			fail(w, http.StatusNotImplemented, err)
+		case err != nil:
+			fail(w, http.StatusUnprocessableEntity, err)
+		default:
+			reply(w, http.StatusOK, result)
+		}
+		return
+	}
+
+	var documents []json.RawMessage
+	err = json.Unmarshal(body, &documents)
+	if err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	batch := Batch{
+		Results: make([]Outcome, len(documents)),
+	}
+	model.Lock()
+	defer model.Unlock()
+	for i, document := range documents {
+		result, err := process(input(document))
+		if err == anomaly.ErrNotScorer {
+			fail(w, http.StatusNotImplemented, err)
+			return
+		} else if err != nil {
+			batch.Results[i].Error = err.Error()
+			continue
+		}
+		// a result that can't be encoded is an error of its document
+		if _, err = json.Marshal(result); err != nil {
+			batch.Results[i].Error = err.Error()
+			continue
+		}
+		batch.Results[i].Result = &result
+	}
+	reply(w, http.StatusOK, batch)
+}
+
+// snapshot writes a model and its learned state
+func (s *Server) snapshot(w http.ResponseWriter, r *http.Request, name string) {
+	model := s.model(name)
+	if model == nil {
+		fail(w, http.StatusNotFound, fmt.Errorf("model %q not found", name))
+		return
+	}
+	model.Lock()
+	data, err := model.Detector.MarshalJSON()
+	model.Unlock()
+	if err == anomaly.ErrNotPersistent {
+		fail(w, http.StatusNotImplemented, err)
+		return
+	} else if err != nil {
+		fail(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(data)
+}
+
+// restore creates or replaces a model from a snapshot
+func (s *Server) restore(w http.ResponseWriter, r *http.Request, name string) {
+	if !valid(name) {
+		fail(w, http.StatusBadRequest, fmt.Errorf("invalid model name %q", name))
+		return
+	}
+	var detector anomaly.Detector
+	err := json.NewDecoder(r.Body).Decode(&detector)
+	if err == anomaly.ErrNotPersistent {
+		fail(w, http.StatusNotImplemented, err)
+		return
+	} else if err != nil {
+		fail(w, http.StatusBadRequest, err)
+		return
+	}
+	model := &Model{
+		Name:     name,
+		Detector: &detector,
+	}
+	info := model.Info()
+	s.add(model, true)
+	reply(w, http.StatusOK, info)
+}
+
+func main() {
+	flag.Parse()
+	log.Printf("listening on %s", *listen)
+	log.Fatal(http.ListenAndServe(*listen, NewServer()))
+}
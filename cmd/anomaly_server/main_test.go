@@ -0,0 +1,206 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"encoding/json"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/pointlander/anomaly"
+)
+
+// do sends a request to the server and checks the status of the response
+func do(t *testing.T, server *Server, method, path, body string, status int) *httptest.ResponseRecorder {
+	t.Helper()
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	w := httptest.NewRecorder()
+	server.ServeHTTP(w, r)
+	if w.Code != status {
+		t.Fatalf("%s %s: status %d, not %d: %s", method, path, w.Code, status, w.Body.String())
+	}
+	return w
+}
+
+// decode decodes the body of a response
+func decode(t *testing.T, w *httptest.ResponseRecorder, value interface{}) {
+	t.Helper()
+	err := json.Unmarshal(w.Body.Bytes(), value)
+	if err != nil {
+		t.Fatalf("%v: %s", err, w.Body.String())
+	}
+}
+
+// TestLifecycle checks that a model restored from a snapshot of another
+// model has its statistics and scores the same
+func TestLifecycle(t *testing.T) {
+	server := NewServer()
+	do(t, server, http.MethodPost, "/v1/models", `{"name":"logins","engine":"complexity","seed":1}`, http.StatusCreated)
+	w := do(t, server, http.MethodPost, "/v1/models/logins/train",
+		`[{"user":"alice"},{"user":"bob"},"raw text"]`, http.StatusOK)
+	var batch Batch
+	decode(t, w, &batch)
+	if len(batch.Results) != 3 {
+		t.Fatalf("%d results, not 3", len(batch.Results))
+	}
+	for i, outcome := range batch.Results {
+		if outcome.Result == nil || outcome.Error != "" {
+			t.Errorf("result %d is %+v", i, outcome)
+		}
+	}
+
+	document := `{"user":"carol"}`
+	var expected anomaly.Result
+	decode(t, do(t, server, http.MethodPost, "/v1/models/logins/score", document, http.StatusOK), &expected)
+	if expected.Surprise == 0 {
+		t.Error("surprise is 0")
+	}
+
+	snapshot := do(t, server, http.MethodGet, "/v1/models/logins/snapshot", "", http.StatusOK).Body.String()
+	do(t, server, http.MethodPut, "/v1/models/copy/snapshot", snapshot, http.StatusOK)
+	var result anomaly.Result
+	decode(t, do(t, server, http.MethodPost, "/v1/models/copy/score", document, http.StatusOK), &result)
+	if result != expected {
+		t.Errorf("restored model scores %+v, not %+v", result, expected)
+	}
+
+	var info, original Info
+	decode(t, do(t, server, http.MethodGet, "/v1/models/copy", "", http.StatusOK), &info)
+	decode(t, do(t, server, http.MethodGet, "/v1/models/logins", "", http.StatusOK), &original)
+	if info.Count != 3 || info.Engine != "complexity" || info.Seed != 1 {
+		t.Errorf("info is %+v", info)
+	}
+	if info.Mean != original.Mean || info.Variance != original.Variance || info.Threshold != original.Threshold {
+		t.Errorf("info is %+v, not %+v", info, original)
+	}
+
+	var infos []Info
+	decode(t, do(t, server, http.MethodGet, "/v1/models", "", http.StatusOK), &infos)
+	if len(infos) != 2 || infos[0].Name != "copy" || infos[1].Name != "logins" {
+		t.Errorf("models are %+v", infos)
+	}
+	do(t, server, http.MethodDelete, "/v1/models/copy", "", http.StatusNoContent)
+	do(t, server, http.MethodGet, "/v1/models/copy", "", http.StatusNotFound)
+}
+
+// TestBatch checks that a document of a batch that isn't valid is an error
+// for that document only
+func TestBatch(t *testing.T) {
+	server := NewServer()
+	do(t, server, http.MethodPost, "/v1/models", `{"name":"users","engine":"neuron","seed":1}`, http.StatusCreated)
+	w := do(t, server, http.MethodPost, "/v1/models/users/train",
+		`[{"user":"alice"},"not a document",{"user":"bob"}]`, http.StatusOK)
+	var batch Batch
+	decode(t, w, &batch)
+	if len(batch.Results) != 3 {
+		t.Fatalf("%d results, not 3", len(batch.Results))
+	}
+	for i, outcome := range batch.Results {
+		if i == 1 {
+			if outcome.Result != nil || outcome.Error != anomaly.ErrNotDocument.Error() {
+				t.Errorf("result %d is %+v", i, outcome)
+			}
+		} else if outcome.Result == nil || outcome.Error != "" {
+			t.Errorf("result %d is %+v", i, outcome)
+		}
+	}
+
+	var info Info
+	decode(t, do(t, server, http.MethodGet, "/v1/models/users", "", http.StatusOK), &info)
+	if info.Count != 2 {
+		t.Errorf("model learned from %d documents, not 2", info.Count)
+	}
+	do(t, server, http.MethodPost, "/v1/models/users/score", `"not a document"`, http.StatusUnprocessableEntity)
+	do(t, server, http.MethodPost, "/v1/models/users/score", `{"user":`, http.StatusBadRequest)
+}
+
+// TestErrors checks the status of requests that fail
+func TestErrors(t *testing.T) {
+	server := NewServer()
+	create := `{"name":"fields","engine":"schema","seed":1}`
+	do(t, server, http.MethodPost, "/v1/models", create, http.StatusCreated)
+	do(t, server, http.MethodPost, "/v1/models", create, http.StatusConflict)
+	do(t, server, http.MethodPost, "/v1/models", `{"name":"other","engine":"unknown"}`, http.StatusBadRequest)
+	do(t, server, http.MethodPost, "/v1/models", `{"name":"a/b","engine":"schema"}`, http.StatusBadRequest)
+
+	for _, request := range []struct {
+		method, path string
+	}{
+		{http.MethodGet, "/v1/models/missing"},
+		{http.MethodDelete, "/v1/models/missing"},
+		{http.MethodPost, "/v1/models/missing/score"},
+		{http.MethodPost, "/v1/models/missing/train"},
+		{http.MethodGet, "/v1/models/missing/snapshot"},
+		{http.MethodGet, "/v2/models"},
+		{http.MethodGet, "/v1/models/fields/unknown"},
+	} {
+		do(t, server, request.method, request.path, `{"user":"alice"}`, http.StatusNotFound)
+	}
+
+	do(t, server, http.MethodPost, "/v1/models/fields/train", `{"user":"alice"}`, http.StatusOK)
+	do(t, server, http.MethodPost, "/v1/models/fields/score", `{"user":"alice"}`, http.StatusNotImplemented)
+	do(t, server, http.MethodPost, "/v1/models/fields/score", `[{"user":"alice"}]`, http.StatusNotImplemented)
+	do(t, server, http.MethodPut, "/v1/models/fields/score", `{"user":"alice"}`, http.StatusMethodNotAllowed)
+	do(t, server, http.MethodPut, "/v1/models/restored/snapshot", `{"engine":"unknown"}`, http.StatusBadRequest)
+}
+
+// TestReply checks that a response that can't be encoded is an internal
+// server error
+func TestReply(t *testing.T) {
+	w := httptest.NewRecorder()
+	reply(w, http.StatusOK, anomaly.Result{Surprise: float32(math.NaN())})
+	if w.Code != http.StatusInternalServerError {
+		t.Fatalf("status %d, not %d", w.Code, http.StatusInternalServerError)
+	}
+	var response Error
+	decode(t, w, &response)
+	if response.Error == "" {
+		t.Error("response has no error")
+	}
+}
+
+// TestConcurrency checks that concurrent requests to a model are serialized,
+// it is meant to be run with -race
+func TestConcurrency(t *testing.T) {
+	server := NewServer()
+	do(t, server, http.MethodPost, "/v1/models", `{"name":"shared","engine":"similarity","seed":1}`, http.StatusCreated)
+	const clients, requests = 8, 16
+	var wait sync.WaitGroup
+	for i := 0; i < clients; i++ {
+		wait.Add(1)
+		go func() {
+			defer wait.Done()
+			for j := 0; j < requests; j++ {
+				for _, request := range []struct {
+					method, path, body string
+				}{
+					{http.MethodPost, "/v1/models/shared/train", `{"user":"alice","count":1}`},
+					{http.MethodPost, "/v1/models/shared/score", `[{"user":"bob"},{"user":"carol"}]`},
+					{http.MethodGet, "/v1/models/shared", ""},
+					{http.MethodGet, "/v1/models/shared/snapshot", ""},
+					{http.MethodGet, "/metrics", ""},
+				} {
+					r := httptest.NewRequest(request.method, request.path, strings.NewReader(request.body))
+					w := httptest.NewRecorder()
+					server.ServeHTTP(w, r)
+					if w.Code != http.StatusOK {
+						t.Errorf("%s %s: status %d: %s", request.method, request.path, w.Code, w.Body.String())
+					}
+				}
+			}
+		}()
+	}
+	wait.Wait()
+
+	var info Info
+	decode(t, do(t, server, http.MethodGet, "/v1/models/shared", "", http.StatusOK), &info)
+	if info.Count != clients*requests {
+		t.Errorf("model learned from %d documents, not %d", info.Count, clients*requests)
+	}
+}
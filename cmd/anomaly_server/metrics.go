@@ -0,0 +1,240 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/pointlander/anomaly"
+)
+
+// family is a metric family in the Prometheus text format
+// https://prometheus.io/docs/instrumenting/exposition_formats/
+type family struct {
+	name, help, kind string
+	samples          bytes.Buffer
+}
+
+// Exposition is a set of metric families in the Prometheus text format
+type Exposition struct {
+	families []*family
+	index    map[string]*family
+}
+
+// NewExposition creates a new empty Exposition
+func NewExposition() *Exposition {
+	return &Exposition{
+		index: make(map[string]*family),
+	}
+}
+
+// labels formats label pairs, the values are escaped
+func labels(pairs ...string) string {
+	if len(pairs) == 0 {
+		return ""
+	}
+	escape := strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+	formatted := make([]string, 0, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		formatted = append(formatted, pairs[i]+`="`+escape.Replace(pairs[i+1])+`"`)
+	}
+	return "{" + strings.Join(formatted, ",") + "}"
+}
+
+// value formats a sample value
+func value(v float64) string {
+	switch {
+	case math.IsInf(v, 1):
+		return "+Inf"
+	case math.IsInf(v, -1):
+		return "-Inf"
+	case math.IsNaN(v):
+		return "NaN"
+	}
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+// family finds or adds a metric family
+func (e *Exposition) family(name, help, kind string) *family {
+	f, ok := e.index[name]
+	if !ok {
+		f = &family{name: name, help: help, kind: kind}
+		e.families = append(e.families, f)
+		e.index[name] = f
+	}
+	return f
+}
+
+// Add adds a sample of a counter or a gauge
+func (e *Exposition) Add(name, help, kind string, v float64, pairs ...string) {
+	f := e.family(name, help, kind)
+	fmt.Fprintf(&f.samples, "%s%s %s\n", name, labels(pairs...), value(v))
+}
+
+// Histogram adds the samples of a histogram
+func (e *Exposition) Histogram(name, help string, h *anomaly.Histogram, pairs ...string) {
+	f := e.family(name, help, "histogram")
+	cumulative := uint64(0)
+	for i, bound := range h.Bounds {
+		cumulative += h.Counts[i]
+		fmt.Fprintf(&f.samples, "%s_bucket%s %d\n", name,
+			labels(append(pairs, "le", value(bound))...), cumulative)
+	}
+	fmt.Fprintf(&f.samples, "%s_bucket%s %d\n", name, labels(append(pairs, "le", "+Inf")...), h.Count)
+	fmt.Fprintf(&f.samples, "%s_sum%s %s\n", name, labels(pairs...), value(h.Sum))
+	fmt.Fprintf(&f.samples, "%s_count%s %d\n", name, labels(pairs...), h.Count)
+}
+
+// Bytes formats the metric families in the Prometheus text format
+func (e *Exposition) Bytes() []byte {
+	var w bytes.Buffer
+	for _, f := range e.families {
+		fmt.Fprintf(&w, "# HELP %s %s\n", f.name, f.help)
+		fmt.Fprintf(&w, "# TYPE %s %s\n", f.name, f.kind)
+		w.Write(f.samples.Bytes())
+	}
+	return w.Bytes()
+}
+
+// collect adds the metrics of a model, the model must be locked
+func (e *Exposition) collect(model *Model) {
+	m, pairs := model.Metrics, []string{"model", model.Name, "engine", model.Engine}
+	operation := func(name string) []string {
+		return append(append([]string(nil), pairs...), "operation", name)
+	}
+
+	e.Add("anomaly_documents_total", "Documents processed by a model.", "counter",
+		float64(m.Trained), operation("train")...)
+	e.Add("anomaly_documents_total", "Documents processed by a model.", "counter",
+		float64(m.Scored), operation("score")...)
+	e.Add("anomaly_errors_total", "Documents a model couldn't process.", "counter",
+		float64(m.Errors), pairs...)
+	e.Add("anomaly_alerts_total", "Documents with a z-score at or beyond the threshold of a model.", "counter",
+		float64(m.Alerts), pairs...)
+	e.Histogram("anomaly_surprise", "Surprise of the documents processed by a model.", m.Surprise, pairs...)
+	e.Histogram("anomaly_latency_seconds", "Seconds taken by a model to process a document.",
+		m.TrainLatency, operation("train")...)
+	e.Histogram("anomaly_latency_seconds", "Seconds taken by a model to process a document.",
+		m.ScoreLatency, operation("score")...)
+	e.Add("anomaly_surprise_mean", "Mean surprise of the documents a model learned from.", "gauge",
+		model.Mean, pairs...)
+	e.Add("anomaly_surprise_deviation", "Standard deviation of the surprise of the documents a model learned from.", "gauge",
+		math.Sqrt(model.Variance()), pairs...)
+	e.Add("anomaly_threshold", "Magnitude of the z-score of an alert.", "gauge", model.Threshold, pairs...)
+
+	if v := model.Vectorizer; v != nil {
+		e.Add("anomaly_vectorizer_cache_hits_total", "Lookups of matrix columns found in the cache.", "counter",
+			float64(atomic.LoadUint64(&v.Hits)), pairs...)
+		e.Add("anomaly_vectorizer_cache_misses_total", "Lookups of matrix columns not found in the cache.", "counter",
+			float64(atomic.LoadUint64(&v.Misses)), pairs...)
+		e.Add("anomaly_vectorizer_cache_size", "Matrix columns in the cache.", "gauge",
+			float64(v.CacheSize()), pairs...)
+	}
+	if tree, ok := model.Network.(anomaly.ContextTree); ok {
+		e.Add("anomaly_context_tree_nodes", "Nodes in the context trees of a model.", "gauge",
+			float64(tree.Nodes()), pairs...)
+	}
+}
+
+// recorder records the status of a response
+type recorder struct {
+	http.ResponseWriter
+	status int
+}
+
+// WriteHeader records the status and writes it
+func (r *recorder) WriteHeader(status int) {
+	r.status = status
+	r.ResponseWriter.WriteHeader(status)
+}
+
+// routes are the routes of the server
+var routes = map[string]bool{
+	"/metrics":                   true,
+	"/v1/engines":                true,
+	"/v1/models":                 true,
+	"/v1/models/{name}":          true,
+	"/v1/models/{name}/score":    true,
+	"/v1/models/{name}/train":    true,
+	"/v1/models/{name}/snapshot": true,
+}
+
+// route is the route of a request path with the model name replaced, paths
+// that aren't routes of the server are other so they don't add labels
+func route(parts []string) string {
+	if len(parts) >= 3 && parts[0] == "v1" && parts[1] == "models" {
+		parts = append([]string{"v1", "models", "{name}"}, parts[3:]...)
+	}
+	path := "/" + strings.Join(parts, "/")
+	if !routes[path] {
+		return "other"
+	}
+	return path
+}
+
+// request counts a request
+type request struct {
+	route, method string
+	status        int
+}
+
+// count counts a served request
+func (s *Server) count(r request) {
+	s.requestsMutex.Lock()
+	s.requests[r]++
+	s.requestsMutex.Unlock()
+}
+
+// metrics writes the metrics of the models and of the server
+func (s *Server) metrics(w http.ResponseWriter, r *http.Request) {
+	e := NewExposition()
+	s.RLock()
+	models := make([]*Model, 0, len(s.Models))
+	for _, model := range s.Models {
+		models = append(models, model)
+	}
+	s.RUnlock()
+	sort.Slice(models, func(i, j int) bool {
+		return models[i].Name < models[j].Name
+	})
+
+	e.Add("anomaly_models", "Models served.", "gauge", float64(len(models)))
+	for _, model := range models {
+		model.Lock()
+		e.collect(model)
+		model.Unlock()
+	}
+
+	s.requestsMutex.Lock()
+	requests := make([]request, 0, len(s.requests))
+	for r := range s.requests {
+		requests = append(requests, r)
+	}
+	sort.Slice(requests, func(i, j int) bool {
+		a, b := requests[i], requests[j]
+		if a.route != b.route {
+			return a.route < b.route
+		}
+		if a.method != b.method {
+			return a.method < b.method
+		}
+		return a.status < b.status
+	})
+	for _, r := range requests {
+		e.Add("anomaly_http_requests_total", "Requests served.", "counter", float64(s.requests[r]),
+			"route", r.route, "method", r.method, "code", strconv.Itoa(r.status))
+	}
+	s.requestsMutex.Unlock()
+
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.Write(e.Bytes())
+}
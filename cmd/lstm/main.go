@@ -3,6 +3,7 @@ package main
 import (
 	"flag"
 	"fmt"
+	"io/ioutil"
 	"log"
 	"math"
 	"math/rand"
@@ -21,10 +22,17 @@ import (
 	T "gorgonia.org/gorgonia"
 
 	"github.com/pointlander/anomaly/lstm"
+	"github.com/pointlander/anomaly/rnn"
 )
 
 var cpuprofile = flag.String("cpuprofile", "", "write cpu profile to file")
 var memprofile = flag.String("memprofile", "", "write memory profile to this file")
+var corpus = flag.String("corpus", "", "train on the lines of this file instead of the embedded corpus")
+var iterations = flag.Int("iterations", 100000, "number of training iterations")
+var checkpoint = flag.String("checkpoint", "", "write checkpoints of the model to this file")
+var every = flag.Int("every", 1000, "iterations between checkpoints and held-out evaluations")
+var resume = flag.Bool("resume", false, "resume training from the checkpoint")
+var holdout = flag.Float64("holdout", 0.1, "fraction of the corpus held out for evaluating perplexity")
 
 func cleanup(sigChan chan os.Signal, doneChan chan bool, profiling bool) {
 	select {
@@ -119,9 +127,39 @@ func main() {
 	}
 	go cleanup(sigChan, doneChan, profiling)
 
-	steps := 8
-	var sentences [][]rune
-	sentencesRaw := strings.Split(lstm.Corpus, "\n")
+	text := lstm.Corpus
+	if *corpus != "" {
+		data, err := ioutil.ReadFile(*corpus)
+		if err != nil {
+			log.Fatal(err)
+		}
+		text = string(data)
+	}
+
+	options := lstm.DefaultOptions()
+	options.Steps = 8
+	options.EmbeddingSize = 10
+	options.HiddenSizes = []int{100}
+	options.LearnRate = 0.000001
+	options.L2Reg = 0.000001
+	options.Clip = 5.0
+	var saved *rnn.Checkpoint
+	if *resume {
+		if *checkpoint == "" {
+			log.Fatal("resume requires a checkpoint")
+		}
+		var err error
+		saved, err = rnn.LoadCheckpoint(*checkpoint)
+		if err != nil {
+			log.Fatal(err)
+		}
+		options = saved.Options
+		log.Printf("resuming from iteration %d", saved.Iteration)
+	}
+
+	steps := options.Steps
+	var sentences, heldout [][]rune
+	sentencesRaw := strings.Split(text, "\n")
 	//sentencesRaw = []string{strings.Join(sentencesRaw, " ")}
 	//sentencesRaw = []string{"abababababababababab"}
 	for _, s := range sentencesRaw {
@@ -135,37 +173,70 @@ func main() {
 		}
 		sentences = append(sentences, s3)
 	}
-	vocabulary := lstm.NewVocabulary(sentences, 1)
-
-	inputSize := len(vocabulary.List)
-	embeddingSize := 10
-	outputSize := len(vocabulary.List)
-	hiddenSizes := []int{100}
-	rnd := rand.New(rand.NewSource(1))
-	m := lstm.NewLSTMModel(rnd, inputSize, embeddingSize, outputSize, hiddenSizes)
+	rand.Shuffle(len(sentences), func(i, j int) {
+		sentences[i], sentences[j] = sentences[j], sentences[i]
+	})
+	if held := int(*holdout * float64(len(sentences))); held > 0 && held < len(sentences) {
+		for _, s := range sentences[len(sentences)-held:] {
+			// only the first END symbol is predicted
+			heldout = append(heldout, s[:len(s)-steps+2])
+		}
+		sentences = sentences[:len(sentences)-held]
+	}
+
+	var m *lstm.Model
+	var vocabulary *lstm.Vocabulary
+	first := 0
+	if saved != nil {
+		m, vocabulary, first = saved.Model, saved.Vocabulary, saved.Iteration+1
+	} else {
+		vocabulary = lstm.NewVocabulary(sentences, 1)
+		inputSize := len(vocabulary.List)
+		outputSize := len(vocabulary.List)
+		rnd := rand.New(rand.NewSource(1))
+		m = lstm.NewLSTMModel(rnd, inputSize, options.EmbeddingSize, outputSize, options.HiddenSizes)
+	}
 	r := lstm.NewCharRNN(m, vocabulary)
 	err := r.ModeLearn(steps)
 	if err != nil {
 		panic(err)
 	}
+	optimizer := options.NewOptimizer()
+	if saved != nil && saved.Optimizer != nil {
+		optimizer = saved.Optimizer
+	}
 
-	predict := lstm.NewCharRNN(m, vocabulary)
-	err = predict.ModeInferencePredict()
-	if err != nil {
-		panic(err)
+	evaluated := first - 1
+	evaluate := func(i int) {
+		if i == evaluated {
+			return
+		}
+		evaluated = i
+		if len(heldout) > 0 {
+			fmt.Printf("Iteration: %d\tHeld-out perplexity: %.3f\n", i, r.Perplexity(heldout))
+		}
+		if *checkpoint != "" {
+			c := rnn.Checkpoint{
+				Iteration:  i,
+				Options:    options,
+				Vocabulary: vocabulary,
+				Model:      m,
+				Optimizer:  optimizer,
+			}
+			if err := c.Save(*checkpoint); err != nil {
+				log.Fatal(err)
+			}
+		}
 	}
 
-	learnrate := 0.000001
-	l2reg := 0.000001
-	clipVal := 5.0
-	solver := T.NewRMSPropSolver(T.WithLearnRate(learnrate), T.WithL2Reg(l2reg), T.WithClip(clipVal))
 	start := time.Now()
 	eStart := start
-	for i := 0; i <= 100000 && !stop; i++ {
+	i := first
+	for ; i <= *iterations && !stop; i++ {
 		// log.Printf("Iter: %d", i)
 		// _, _, err := m.run(i, solver)
 		j := rand.Intn(len(sentences))
-		cost, perp, err := r.Learn(sentences[j], i, solver)
+		cost, perp, err := r.Learn(sentences[j], i, optimizer)
 		if err != nil {
 			panic(fmt.Sprintf("%+v", err))
 		}
@@ -183,7 +254,7 @@ func main() {
 
 		if i%10 == 0 {
 			log.Printf("Going to predict now")
-			predict.Predict()
+			r.Predict()
 			log.Printf("Done predicting")
 
 			timetaken := time.Since(eStart)
@@ -191,6 +262,10 @@ func main() {
 			eStart = time.Now()
 		}
 
+		if *every > 0 && i > first && i%*every == 0 {
+			evaluate(i)
+		}
+
 		if *memprofile != "" && i == 1000 {
 			f, err := os.Create(*memprofile)
 			if err != nil {
@@ -202,6 +277,9 @@ func main() {
 		}
 
 	}
+	if i > first {
+		evaluate(i - 1)
+	}
 
 	graph()
 
@@ -47,6 +47,8 @@ type CDF16 struct {
 	Context []uint16
 	First   int
 	Mixin   [][]uint16
+	// nodes is the number of nodes in the context tree
+	nodes int
 }
 
 // NewCDF16 creates a new CDF16 with a given context depth
@@ -69,6 +71,7 @@ func NewCDF16() *CDF16 {
 		Root:    root,
 		Context: make([]uint16, CDF16Depth),
 		Mixin:   mixin,
+		nodes:   1,
 	}
 }
 
@@ -135,6 +138,7 @@ func (c *CDF16) Update(s uint16) {
 		if node == nil {
 			node = NewNode16()
 			n.Children[context[current]] = node
+			c.nodes++
 		}
 		update(node, (current+1)%length, depth+1)
 	}
@@ -145,6 +149,11 @@ func (c *CDF16) Update(s uint16) {
 	}
 }
 
+// Nodes is the number of nodes in the context tree
+func (c *CDF16) Nodes() int {
+	return c.nodes
+}
+
 // Complexity is an entorpy based anomaly detector
 type Complexity struct {
 	*CDF16
@@ -157,18 +166,38 @@ func NewComplexity(rnd *rand.Rand, vectorizer *Vectorizer) Network {
 	}
 }
 
-// Train trains the Complexity
-func (c *Complexity) Train(input []byte) (surprise, uncertainty float32) {
-	var total uint64
-	for _, s := range input {
+// profile computes the surprise of each byte of the input using a model
+func profile(c *CDF16, input []byte) []float32 {
+	profile := make([]float32, len(input))
+	for i, s := range input {
 		model := c.Model()
-		total += uint64(bits.Len16(model[s+1] - model[s]))
+		profile[i] = float32(CDF16Fixed + 1 - bits.Len16(model[s+1]-model[s]))
 		c.AddContext(uint16(s))
 	}
 	c.ResetContext()
+	return profile
+}
+
+// Profile computes the surprise of each byte of the input
+func (c *Complexity) Profile(input []byte) []float32 {
+	return profile(c.CDF16, input)
+}
+
+// Score computes the surprise with the Complexity without learning
+func (c *Complexity) Score(input []byte) (surprise, uncertainty float32) {
+	var total float32
+	for _, cost := range c.Profile(input) {
+		total += cost
+	}
+	return total / float32(len(input)), 0
+}
+
+// Train trains the Complexity
+func (c *Complexity) Train(input []byte) (surprise, uncertainty float32) {
+	surprise, uncertainty = c.Score(input)
 	for _, s := range input {
 		c.Update(uint16(s))
 	}
 	c.ResetContext()
-	return float32(CDF16Fixed+1) - (float32(total) / float32(len(input))), 0
+	return
 }
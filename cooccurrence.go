@@ -0,0 +1,161 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// coOccurrenceWidth is the width of the co-occurrence sketches
+	coOccurrenceWidth = 1 << 18
+	// coOccurrenceDepth is the depth of the co-occurrence sketches
+	coOccurrenceDepth = 4
+	// coOccurrenceFields is the maximum number of field values per document
+	coOccurrenceFields = 64
+	// coOccurrenceSupport is the number of documents a value must be seen in
+	coOccurrenceSupport = 8
+	// coOccurrenceExpected is the minimum expected count of an improbable pair
+	coOccurrenceExpected = 2
+	// coOccurrencePMI is the pointwise mutual information of an improbable pair
+	coOccurrencePMI = -3
+)
+
+// FieldValue is the value of a JSON path
+type FieldValue struct {
+	Path, Value string
+}
+
+// CoOccurrencePair is an improbable combination of two field values
+type CoOccurrencePair struct {
+	A, B            FieldValue
+	Count, Expected float64
+	PMI             float64
+}
+
+// String formats the pair
+func (p CoOccurrencePair) String() string {
+	return fmt.Sprintf("%s=%s with %s=%s: seen %.0f times, expected %.1f, PMI %.1f bits",
+		p.A.Path, p.A.Value, p.B.Path, p.B.Value, p.Count, p.Expected, p.PMI)
+}
+
+// CoOccurrenceResult is the result of co-occurrence detection for a document
+type CoOccurrenceResult struct {
+	Surprise float32
+	Pairs    []CoOccurrencePair
+}
+
+// CoOccurrence detects improbable combinations of field values using the
+// pointwise mutual information of pairs of values
+// https://en.wikipedia.org/wiki/Pointwise_mutual_information
+type CoOccurrence struct {
+	Fields    map[string]bool
+	Values    *CountMinSketch
+	Pairs     *CountMinSketch
+	Documents uint64
+}
+
+// NewCoOccurrence creates a new co-occurrence detector over all fields
+func NewCoOccurrence(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+	return NewCoOccurrenceFactory()(rnd, vectorizer)
+}
+
+// NewCoOccurrenceFactory creates a factory for co-occurrence detectors over
+// the selected JSON paths, e.g. "$.country" and "$.currency"
+func NewCoOccurrenceFactory(fields ...string) NetworkFactory {
+	return func(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+		selected := make(map[string]bool)
+		for _, field := range fields {
+			selected[field] = true
+		}
+		return &CoOccurrence{
+			Fields: selected,
+			Values: NewCountMinSketch(coOccurrenceWidth, coOccurrenceDepth),
+			Pairs:  NewCountMinSketch(coOccurrenceWidth, coOccurrenceDepth),
+		}
+	}
+}
+
+// Detect computes the improbable pairs of a document and then learns its pairs
+func (c *CoOccurrence) Detect(input []byte) *CoOccurrenceResult {
+	var object map[string]interface{}
+	err := json.Unmarshal(input, &object)
+	if err != nil {
+		panic(err)
+	}
+
+	var values []FieldValue
+	seen := make(map[FieldValue]bool)
+	Walk(object, func(context []string, value interface{}) {
+		path := formatPath(context)
+		if len(c.Fields) > 0 && !c.Fields[path] {
+			return
+		}
+		v := FieldValue{Path: path, Value: fmt.Sprint(value)}
+		if seen[v] {
+			return
+		}
+		seen[v] = true
+		values = append(values, v)
+	})
+	sort.Slice(values, func(i, j int) bool {
+		if values[i].Path == values[j].Path {
+			return values[i].Value < values[j].Value
+		}
+		return values[i].Path < values[j].Path
+	})
+	// the values are capped after sorting so the same values of a document
+	// are always kept
+	if len(values) > coOccurrenceFields {
+		values = values[:coOccurrenceFields]
+	}
+
+	hashes := make([]uint64, len(values))
+	for i, v := range values {
+		hashes[i] = hash([]string{v.Path, "\x00", v.Value})
+	}
+
+	result, n := &CoOccurrenceResult{}, float64(c.Documents)
+	for i, a := range values {
+		for j := i + 1; j < len(values); j++ {
+			b := values[j]
+			h := hash([]string{a.Path, "\x00", a.Value, "\x00", b.Path, "\x00", b.Value})
+			ca, cb := float64(c.Values.Count(hashes[i])), float64(c.Values.Count(hashes[j]))
+			if a.Path != b.Path && ca >= coOccurrenceSupport && cb >= coOccurrenceSupport {
+				count, expected := float64(c.Pairs.Count(h)), ca*cb/n
+				pmi := math.Log2((count + 1) / (expected + 1))
+				if expected >= coOccurrenceExpected && pmi <= coOccurrencePMI {
+					result.Pairs = append(result.Pairs, CoOccurrencePair{
+						A:        a,
+						B:        b,
+						Count:    count,
+						Expected: expected,
+						PMI:      pmi,
+					})
+					result.Surprise -= float32(pmi)
+				}
+			}
+			c.Pairs.Add(h)
+		}
+	}
+	for _, h := range hashes {
+		c.Values.Add(h)
+	}
+	c.Documents++
+
+	sort.SliceStable(result.Pairs, func(i, j int) bool {
+		return result.Pairs[i].PMI < result.Pairs[j].PMI
+	})
+	return result
+}
+
+// Train computes the surprise with co-occurrence detection
+func (c *CoOccurrence) Train(input []byte) (surprise, uncertainty float32) {
+	return c.Detect(input).Surprise, 0
+}
@@ -0,0 +1,103 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"strings"
+	"testing"
+)
+
+// TestCoOccurrence checks the improbable pairs of a document after learning
+// from other documents
+func TestCoOccurrence(t *testing.T) {
+	documents := append(repeat(`{"country":"US","currency":"USD","id":"1"}`, 20),
+		repeat(`{"country":"FR","currency":"EUR","id":"2"}`, 20)...)
+	tests := []struct {
+		name     string
+		fields   []string
+		count    int
+		document string
+		pairs    []string
+	}{
+		{
+			name:     "normal",
+			count:    40,
+			document: `{"country":"US","currency":"USD","id":"1"}`,
+		},
+		{
+			name:     "improbable",
+			count:    40,
+			document: `{"country":"US","currency":"EUR","id":"1"}`,
+			pairs: []string{
+				"$.country=US with $.currency=EUR: seen 0 times, expected 10.0, PMI -3.5 bits",
+				"$.currency=EUR with $.id=1: seen 0 times, expected 10.0, PMI -3.5 bits",
+			},
+		},
+		{
+			name:     "selected fields",
+			fields:   []string{"$.country", "$.currency"},
+			count:    40,
+			document: `{"country":"US","currency":"EUR","id":"1"}`,
+			pairs:    []string{"$.country=US with $.currency=EUR: seen 0 times, expected 10.0, PMI -3.5 bits"},
+		},
+		{
+			name:     "too little support",
+			count:    14,
+			document: `{"country":"US","currency":"EUR","id":"1"}`,
+		},
+	}
+	for _, test := range tests {
+		cooccurrence := NewCoOccurrenceFactory(test.fields...)(nil, nil).(*CoOccurrence)
+		for _, document := range documents[20-test.count/2 : 20+test.count/2] {
+			cooccurrence.Detect([]byte(document))
+		}
+		result := cooccurrence.Detect([]byte(test.document))
+		pairs, surprise := []string(nil), float32(0)
+		for _, pair := range result.Pairs {
+			pairs = append(pairs, pair.String())
+			surprise -= float32(pair.PMI)
+		}
+		if strings.Join(pairs, "\n") != strings.Join(test.pairs, "\n") {
+			t.Errorf("%s: pairs are %q, expected %q", test.name, pairs, test.pairs)
+		}
+		if math.Abs(float64(result.Surprise-surprise)) > 1e-5 {
+			t.Errorf("%s: surprise is %v, expected %v", test.name, result.Surprise, surprise)
+		}
+	}
+}
+
+// TestCoOccurrenceFields checks that only the first sorted values of a
+// document with many values are paired
+func TestCoOccurrenceFields(t *testing.T) {
+	document := func(first, rest string) []byte {
+		fields := make([]string, 100)
+		for i := range fields {
+			value := rest
+			if i == 0 {
+				value = first
+			}
+			fields[i] = fmt.Sprintf(`"k%03d":%q`, i, value)
+		}
+		return []byte("{" + strings.Join(fields, ",") + "}")
+	}
+	for i := 0; i < 3; i++ {
+		cooccurrence := NewCoOccurrence(nil, nil).(*CoOccurrence)
+		for j := 0; j < 20; j++ {
+			cooccurrence.Detect(document("x", "x"))
+			cooccurrence.Detect(document("y", "y"))
+		}
+		result := cooccurrence.Detect(document("x", "y"))
+		if len(result.Pairs) != coOccurrenceFields-1 {
+			t.Fatalf("%d pairs, expected %d", len(result.Pairs), coOccurrenceFields-1)
+		}
+		for _, pair := range result.Pairs {
+			if pair.A.Path != "$.k000" || pair.B.Path >= fmt.Sprintf("$.k%03d", coOccurrenceFields) {
+				t.Errorf("pair %v is of values past the first %d", pair, coOccurrenceFields)
+			}
+		}
+	}
+}
@@ -0,0 +1,427 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"os"
+	"sort"
+	"time"
+
+	"github.com/pointlander/anomaly/attention"
+	"github.com/pointlander/anomaly/rnn"
+)
+
+const (
+	// DetectorVectorSize is the size of the JSON document vectors of detectors
+	DetectorVectorSize = 1024
+	// DefaultThreshold is the default z-score of an alert
+	DefaultThreshold = 3
+)
+
+// engine creates networks from JSON options
+type engine struct {
+	// documents is true for engines that only accept JSON documents
+	documents bool
+	factory   func(options json.RawMessage) (NetworkFactory, error)
+}
+
+// decodeOptions decodes JSON options into the defaults in v, unknown options
+// are an error
+func decodeOptions(options json.RawMessage, v interface{}) error {
+	if len(bytes.TrimSpace(options)) == 0 {
+		return nil
+	}
+	decoder := json.NewDecoder(bytes.NewReader(options))
+	decoder.DisallowUnknownFields()
+	return decoder.Decode(v)
+}
+
+// withoutOptions is an engine with no options
+func withoutOptions(documents bool, factory NetworkFactory) engine {
+	return engine{
+		documents: documents,
+		factory: func(options json.RawMessage) (NetworkFactory, error) {
+			return factory, decodeOptions(options, &struct{}{})
+		},
+	}
+}
+
+// recurrent is an engine of recurrent networks with options, options that
+// aren't valid are an error
+func recurrent(factory func(options rnn.Options) NetworkFactory) engine {
+	return recurrentDefaults(rnn.DefaultOptions, factory)
+}
+
+// recurrentDefaults creates a recurrent engine from the JSON encoded options,
+// starting from the given default options
+func recurrentDefaults(defaults func() rnn.Options, factory func(options rnn.Options) NetworkFactory) engine {
+	return engine{false, func(options json.RawMessage) (NetworkFactory, error) {
+		o := defaults()
+		if err := decodeOptions(options, &o); err != nil {
+			return nil, err
+		}
+		if err := o.Validate(); err != nil {
+			return nil, err
+		}
+		return factory(o), nil
+	}}
+}
+
+// engines are the engines detectors can be created from
+var engines = map[string]engine{
+	"complexity": withoutOptions(false, NewComplexity),
+	"meta":       withoutOptions(false, NewMeta),
+	"similarity": withoutOptions(true, NewAverageSimilarity),
+	"lof":        withoutOptions(true, NewLOF),
+	"schema":     withoutOptions(true, NewSchema),
+	"fields":     withoutOptions(true, NewFieldStatistics),
+	"novelty":    withoutOptions(true, NewNovelty),
+	"cooccurrence": {true, func(options json.RawMessage) (NetworkFactory, error) {
+		var o struct {
+			// Fields are the JSON paths of the values, all paths if empty
+			Fields []string
+		}
+		err := decodeOptions(options, &o)
+		return NewCoOccurrenceFactory(o.Fields...), err
+	}},
+	"neuron": {true, func(options json.RawMessage) (NetworkFactory, error) {
+		o := DefaultNeuronOptions()
+		err := decodeOptions(options, &o)
+		return NewNeuronFactory(o), err
+	}},
+	"autoencoder": {true, func(options json.RawMessage) (NetworkFactory, error) {
+		o := DefaultAutoencoderOptions()
+		if err := decodeOptions(options, &o); err != nil {
+			return nil, err
+		}
+		if err := o.Validate(); err != nil {
+			return nil, err
+		}
+		return NewAutoencoderFactory(o), nil
+	}},
+	"vae": {true, func(options json.RawMessage) (NetworkFactory, error) {
+		o := DefaultVAEOptions()
+		if err := decodeOptions(options, &o); err != nil {
+			return nil, err
+		}
+		if err := o.Validate(); err != nil {
+			return nil, err
+		}
+		return NewVAEFactory(o), nil
+	}},
+	"lstm": recurrent(NewLSTMFactory),
+	"gru":  recurrent(NewGRUFactory),
+	"elman": recurrent(func(options rnn.Options) NetworkFactory {
+		return NewRNNFactory(rnn.Elman{}, options)
+	}),
+	"mgu": recurrent(func(options rnn.Options) NetworkFactory {
+		return NewRNNFactory(rnn.MGU{}, options)
+	}),
+	"indrnn": recurrent(func(options rnn.Options) NetworkFactory {
+		return NewRNNFactory(rnn.IndRNN{}, options)
+	}),
+	"bidirectional": recurrentDefaults(rnn.DefaultBidirectionalOptions, func(options rnn.Options) NetworkFactory {
+		return NewBidirectionalFactory(rnn.LSTM{}, options)
+	}),
+	"embedding": recurrent(func(options rnn.Options) NetworkFactory {
+		return NewRecurrentEmbeddingFactory(rnn.LSTM{}, options, rnn.PoolingMean, NewAverageSimilarity)
+	}),
+	"attention": {false, func(options json.RawMessage) (NetworkFactory, error) {
+		o := attention.DefaultOptions()
+		if err := decodeOptions(options, &o); err != nil {
+			return nil, err
+		}
+		if err := o.Validate(); err != nil {
+			return nil, err
+		}
+		return NewAttentionFactory(o), nil
+	}},
+}
+
+// Engines returns the names of the engines detectors can be created from
+func Engines() []string {
+	names := make([]string, 0, len(engines))
+	for name := range engines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Statistics are the running mean and variance of the surprise of the
+// documents a detector has learned from
+// https://en.wikipedia.org/wiki/Algorithms_for_calculating_variance#Welford's_online_algorithm
+type Statistics struct {
+	Count int     `json:"count"`
+	Mean  float64 `json:"mean"`
+	M2    float64 `json:"m2"`
+}
+
+// Add adds a surprise to the statistics
+func (s *Statistics) Add(surprise float32) {
+	x := float64(surprise)
+	if math.IsNaN(x) || math.IsInf(x, 0) {
+		return
+	}
+	s.Count++
+	delta := x - s.Mean
+	s.Mean += delta / float64(s.Count)
+	s.M2 += delta * (x - s.Mean)
+}
+
+// Variance is the variance of the surprise
+func (s *Statistics) Variance() float64 {
+	if s.Count < 2 {
+		return 0
+	}
+	return s.M2 / float64(s.Count-1)
+}
+
+// ZScore is the number of standard deviations a surprise is from the mean
+// surprise, it is 0 until the variance is known
+func (s *Statistics) ZScore(surprise float32) float64 {
+	deviation := math.Sqrt(s.Variance())
+	if deviation == 0 || math.IsNaN(float64(surprise)) || math.IsInf(float64(surprise), 0) {
+		return 0
+	}
+	return (float64(surprise) - s.Mean) / deviation
+}
+
+// Result is the surprise of a document
+type Result struct {
+	Surprise    float32 `json:"surprise"`
+	Uncertainty float32 `json:"uncertainty"`
+	// ZScore is the surprise normalized by the statistics of the detector
+	// before the document
+	ZScore float64 `json:"zscore"`
+	// Alert is true when the z-score is at or beyond the threshold of the
+	// detector
+	Alert bool `json:"alert"`
+}
+
+// ErrNotDocument is returned when an engine that only accepts JSON documents
+// is given something else
+var ErrNotDocument = errors.New("input isn't a JSON document")
+
+// Detector is a network created from a named engine that keeps statistics of
+// the surprise of the documents it learns from and metrics of the documents
+// it processes. A detector isn't safe for concurrent use
+type Detector struct {
+	Engine  string
+	Options json.RawMessage
+	Seed    int64
+	// Threshold is the magnitude of the z-score of an alert, 0 disables
+	// alerts
+	Threshold float64
+	Statistics
+	Network    Network
+	Vectorizer *Vectorizer
+	Metrics    *Metrics
+	documents  bool
+}
+
+// NewDetector creates a detector from a named engine with JSON options, empty
+// options are the defaults of the engine
+func NewDetector(name string, options json.RawMessage, seed int64) (*Detector, error) {
+	e, ok := engines[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown engine %q", name)
+	}
+	if len(bytes.TrimSpace(options)) == 0 {
+		options = nil
+	}
+	factory, err := e.factory(options)
+	if err != nil {
+		return nil, fmt.Errorf("options of engine %q: %v", name, err)
+	}
+	rnd := rand.New(rand.NewSource(seed))
+	vectorizer := NewVectorizer(DetectorVectorSize, true, NewLFSR32Source)
+	return &Detector{
+		Engine:     name,
+		Options:    options,
+		Seed:       seed,
+		Threshold:  DefaultThreshold,
+		Network:    factory(rnd, vectorizer),
+		Vectorizer: vectorizer,
+		Metrics:    NewMetrics(),
+		documents:  e.documents,
+	}, nil
+}
+
+// check checks that the input can be given to the network
+func (d *Detector) check(input []byte) error {
+	if !d.documents {
+		if len(input) == 0 {
+			return errors.New("input is empty")
+		}
+		return nil
+	}
+	var object map[string]interface{}
+	if json.Unmarshal(input, &object) != nil || object == nil {
+		return ErrNotDocument
+	}
+	return nil
+}
+
+// empty is true for a document that has no path/value words for the
+// vector of a vector network. Its vector is zero and can't be normalized, so
+// it isn't given to the network
+func (d *Detector) empty(input []byte) bool {
+	if _, ok := d.Network.(vectorNetwork); !ok || !d.documents {
+		return false
+	}
+	var object map[string]interface{}
+	json.Unmarshal(input, &object)
+	empty := true
+	Words(object, func(word []string) {
+		empty = false
+	})
+	return empty
+}
+
+// normalize computes the z-score of a result and whether it is an alert
+func (d *Detector) normalize(result *Result) {
+	result.ZScore = d.ZScore(result.Surprise)
+	result.Alert = d.Threshold > 0 && math.Abs(result.ZScore) >= d.Threshold
+}
+
+// Score computes the surprise of an input without learning
+func (d *Detector) Score(input []byte) (result Result, err error) {
+	if err = d.check(input); err != nil {
+		d.Metrics.Errors++
+		return result, err
+	}
+	start := time.Now()
+	switch network := d.Network.(type) {
+	case Scorer:
+		result.Surprise, result.Uncertainty = network.Score(input)
+	case vectorNetwork:
+		if !d.empty(input) {
+			var object map[string]interface{}
+			json.Unmarshal(input, &object)
+			result.Surprise = network.ScoreVector(Normalize(network.VectorizeContext(object, nil)))
+		}
+	default:
+		d.Metrics.Errors++
+		return result, ErrNotScorer
+	}
+	d.normalize(&result)
+	d.Metrics.observe(result, false, time.Since(start))
+	return result, nil
+}
+
+// Train computes the surprise of an input, learns from it and adds the
+// surprise to the statistics. An empty document has a surprise of 0 and isn't
+// learned from
+func (d *Detector) Train(input []byte) (result Result, err error) {
+	if err = d.check(input); err != nil {
+		d.Metrics.Errors++
+		return result, err
+	}
+	start := time.Now()
+	if d.empty(input) {
+		d.normalize(&result)
+		d.Metrics.observe(result, false, time.Since(start))
+		return result, nil
+	}
+	result.Surprise, result.Uncertainty = d.Network.Train(input)
+	d.normalize(&result)
+	d.Metrics.observe(result, true, time.Since(start))
+	d.Add(result.Surprise)
+	return result, nil
+}
+
+// detectorJSON is the JSON form of a detector
+type detectorJSON struct {
+	Engine     string          `json:"engine"`
+	Options    json.RawMessage `json:"options,omitempty"`
+	Seed       int64           `json:"seed"`
+	Threshold  float64         `json:"threshold"`
+	Statistics Statistics      `json:"statistics"`
+	Model      json.RawMessage `json:"model"`
+}
+
+// MarshalJSON encodes the detector and the learned state of its network as
+// JSON
+func (d *Detector) MarshalJSON() ([]byte, error) {
+	network, ok := d.Network.(Persistent)
+	if !ok {
+		return nil, ErrNotPersistent
+	}
+	model, err := network.MarshalJSON()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(detectorJSON{
+		Engine:     d.Engine,
+		Options:    d.Options,
+		Seed:       d.Seed,
+		Threshold:  d.Threshold,
+		Statistics: d.Statistics,
+		Model:      model,
+	})
+}
+
+// UnmarshalJSON creates a detector from its engine and options and loads the
+// learned state of its network from JSON
+func (d *Detector) UnmarshalJSON(data []byte) error {
+	snapshot := detectorJSON{
+		Threshold: DefaultThreshold,
+	}
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return err
+	}
+	detector, err := NewDetector(snapshot.Engine, snapshot.Options, snapshot.Seed)
+	if err != nil {
+		return err
+	}
+	network, ok := detector.Network.(Persistent)
+	if !ok {
+		return ErrNotPersistent
+	}
+	if err = network.UnmarshalJSON(snapshot.Model); err != nil {
+		return err
+	}
+	detector.Statistics, detector.Threshold = snapshot.Statistics, snapshot.Threshold
+	*d = *detector
+	return nil
+}
+
+// Save writes the detector to a file, the file is replaced only once the
+// detector has been written
+func (d *Detector) Save(name string) error {
+	data, err := json.Marshal(d)
+	if err != nil {
+		return err
+	}
+	temp := name + ".tmp"
+	err = ioutil.WriteFile(temp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, name)
+}
+
+// LoadDetector reads a detector from a file
+func LoadDetector(name string) (*Detector, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var detector Detector
+	err = json.Unmarshal(data, &detector)
+	if err != nil {
+		return nil, err
+	}
+	return &detector, nil
+}
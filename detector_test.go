@@ -0,0 +1,175 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// TestEngines checks that a detector can be created from each engine and
+// that options that aren't valid are an error
+func TestEngines(t *testing.T) {
+	document := []byte(`{"user":"alice","action":"login","ok":true}`)
+	for _, name := range Engines() {
+		detector, err := NewDetector(name, nil, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for i := 0; i < 3; i++ {
+			if _, err = detector.Train(document); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		if _, err = detector.Score(document); err != nil && err != ErrNotScorer {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+
+	for name, options := range map[string]string{
+		"unknown":       `{}`,
+		"complexity":    `{"Size":1}`,
+		"cooccurrence":  `{"Fields":"$.user"}`,
+		"lstm":          `{"Steps":1}`,
+		"mgu":           `{"HiddenSizes":[]}`,
+		"embedding":     `{"EmbeddingSize":0}`,
+		"bidirectional": `{"Stateful":true,"Steps":0}`,
+		"attention":     `{"Window":0}`,
+		"autoencoder":   `{"Hidden":[16,0]}`,
+		"vae":           `{"Latent":-1}`,
+	} {
+		if _, err := NewDetector(name, json.RawMessage(options), 1); err == nil {
+			t.Errorf("%s: options %s aren't an error", name, options)
+		}
+	}
+}
+
+// TestPersistence checks that a detector loaded from JSON saves and scores
+// the same as the detector it was saved from
+func TestPersistence(t *testing.T) {
+	documents := [][]byte{
+		[]byte(`{"user":"alice","action":"login","ok":true}`),
+		[]byte(`{"user":"bob","action":"logout","ok":true,"size":3}`),
+		[]byte(`{"user":"alice","action":"upload","ok":false,"tags":["a","b"]}`),
+	}
+	document := []byte(`{"user":"carol","action":"login","ok":false}`)
+	for _, name := range Engines() {
+		detector, err := NewDetector(name, nil, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		for _, document := range documents {
+			if _, err = detector.Train(document); err != nil {
+				t.Fatalf("%s: %v", name, err)
+			}
+		}
+		data, err := json.Marshal(detector)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		var loaded Detector
+		if err = json.Unmarshal(data, &loaded); err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+		again, err := json.Marshal(&loaded)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if !bytes.Equal(data, again) {
+			t.Errorf("%s: loaded detector saves differently", name)
+		}
+		if loaded.Statistics != detector.Statistics {
+			t.Errorf("%s: statistics are %+v, not %+v", name, loaded.Statistics, detector.Statistics)
+		}
+		if name == "vae" {
+			// the variational autoencoder samples its latent variables
+			continue
+		}
+		expected, err := detector.Score(document)
+		if err == ErrNotScorer {
+			continue
+		} else if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		result, err := loaded.Score(document)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if result != expected {
+			t.Errorf("%s: loaded detector scores %+v, not %+v", name, result, expected)
+		}
+	}
+
+	detector, err := NewDetector("neuron", nil, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err = json.Unmarshal([]byte(`{"engine":"neuron","model":{"weights":[[1]]}}`), detector); err == nil {
+		t.Error("weights of the wrong size aren't an error")
+	}
+}
+
+// TestEmpty checks that a document without path/value words has a surprise
+// of 0 and isn't learned from, so the detector can still be saved
+func TestEmpty(t *testing.T) {
+	empty := []byte(`{"o":{"p":"x"}}`)
+	for _, name := range Engines() {
+		detector, err := NewDetector(name, nil, 1)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, err = detector.Train([]byte(`{"user":"alice"}`)); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		result, err := detector.Train(empty)
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if _, ok := detector.Network.(vectorNetwork); ok {
+			if result.Surprise != 0 {
+				t.Errorf("%s: surprise is %v, not 0", name, result.Surprise)
+			}
+			if detector.Count != 1 {
+				t.Errorf("%s: detector learned from %d documents, not 1", name, detector.Count)
+			}
+			if result, err = detector.Score(empty); err != nil || result.Surprise != 0 {
+				t.Errorf("%s: scores %+v, %v", name, result, err)
+			}
+		}
+		if _, err = json.Marshal(detector); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+}
+
+// TestZScore checks the z-score of a surprise against the statistics of the
+// surprises before it
+func TestZScore(t *testing.T) {
+	var statistics Statistics
+	if z := statistics.ZScore(1); z != 0 {
+		t.Errorf("z-score without statistics is %v", z)
+	}
+	statistics.Add(1)
+	if z := statistics.ZScore(2); z != 0 {
+		t.Errorf("z-score without variance is %v", z)
+	}
+	for _, surprise := range []float32{2, 3, 4, float32(math.NaN()), float32(math.Inf(1))} {
+		statistics.Add(surprise)
+	}
+	if statistics.Count != 4 || statistics.Mean != 2.5 {
+		t.Errorf("statistics are %+v", statistics)
+	}
+	// the sample standard deviation of 1, 2, 3, 4 is sqrt(5/3)
+	if z, expected := statistics.ZScore(5), 2.5/math.Sqrt(5.0/3); math.Abs(z-expected) > 1e-12 {
+		t.Errorf("z-score is %v, not %v", z, expected)
+	}
+	if z := statistics.ZScore(float32(math.Inf(-1))); z != 0 {
+		t.Errorf("z-score of an infinite surprise is %v", z)
+	}
+}
@@ -0,0 +1,109 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+)
+
+const (
+	// DifferenceAdded is a value only in the second document
+	DifferenceAdded = "added"
+	// DifferenceRemoved is a value only in the first document
+	DifferenceRemoved = "removed"
+	// DifferenceChanged is a value that differs between the documents
+	DifferenceChanged = "changed"
+	// DifferenceType is a value with a different type in each document
+	DifferenceType = "type"
+)
+
+// Difference is a structural difference between two JSON documents
+type Difference struct {
+	Path string
+	Kind string
+	A, B interface{}
+}
+
+// String formats the difference
+func (d Difference) String() string {
+	switch d.Kind {
+	case DifferenceAdded:
+		return fmt.Sprintf("%s: added %v", d.Path, d.B)
+	case DifferenceRemoved:
+		return fmt.Sprintf("%s: removed %v", d.Path, d.A)
+	case DifferenceType:
+		return fmt.Sprintf("%s: %s %v became %s %v", d.Path, schemaType(d.A), d.A, schemaType(d.B), d.B)
+	}
+	return fmt.Sprintf("%s: %v became %v", d.Path, d.A, d.B)
+}
+
+// Diff computes the structural differences between two JSON documents
+func Diff(a, b []byte) ([]Difference, error) {
+	var x, y interface{}
+	err := json.Unmarshal(a, &x)
+	if err != nil {
+		return nil, err
+	}
+	err = json.Unmarshal(b, &y)
+	if err != nil {
+		return nil, err
+	}
+
+	var differences []Difference
+	var diff func(path string, a, b interface{})
+	diff = func(path string, a, b interface{}) {
+		if schemaType(a) != schemaType(b) {
+			differences = append(differences, Difference{Path: path, Kind: DifferenceType, A: a, B: b})
+			return
+		}
+		switch a := a.(type) {
+		case map[string]interface{}:
+			b := b.(map[string]interface{})
+			keys := make([]string, 0, len(a)+len(b))
+			for key := range a {
+				keys = append(keys, key)
+			}
+			for key := range b {
+				if _, found := a[key]; !found {
+					keys = append(keys, key)
+				}
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				x, inA := a[key]
+				y, inB := b[key]
+				sub := path + "." + key
+				if !inB {
+					differences = append(differences, Difference{Path: sub, Kind: DifferenceRemoved, A: x})
+				} else if !inA {
+					differences = append(differences, Difference{Path: sub, Kind: DifferenceAdded, B: y})
+				} else {
+					diff(sub, x, y)
+				}
+			}
+		case []interface{}:
+			b := b.([]interface{})
+			for i := 0; i < len(a) || i < len(b); i++ {
+				sub := fmt.Sprintf("%s[%d]", path, i)
+				if i >= len(b) {
+					differences = append(differences, Difference{Path: sub, Kind: DifferenceRemoved, A: a[i]})
+				} else if i >= len(a) {
+					differences = append(differences, Difference{Path: sub, Kind: DifferenceAdded, B: b[i]})
+				} else {
+					diff(sub, a[i], b[i])
+				}
+			}
+		default:
+			if !reflect.DeepEqual(a, b) {
+				differences = append(differences, Difference{Path: path, Kind: DifferenceChanged, A: a, B: b})
+			}
+		}
+	}
+	diff("$", x, y)
+	return differences, nil
+}
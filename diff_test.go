@@ -0,0 +1,43 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestDiff checks the structural differences between documents
+func TestDiff(t *testing.T) {
+	tests := []struct {
+		a, b        string
+		differences []string
+	}{
+		{`{"a":1}`, `{"a":1}`, nil},
+		{`{"a":1}`, `{"a":2}`, []string{"$.a: 1 became 2"}},
+		{`{"a":1}`, `{"a":"1"}`, []string{"$.a: number 1 became string 1"}},
+		{`{"a":1,"b":true}`, `{"a":1,"c":null}`, []string{"$.b: removed true", "$.c: added <nil>"}},
+		{`{"o":{"p":"x"}}`, `{"o":{"p":"y","q":"z"}}`, []string{"$.o.p: x became y", "$.o.q: added z"}},
+		{`{"l":[1,2,3]}`, `{"l":[1,4]}`, []string{"$.l[1]: 2 became 4", "$.l[2]: removed 3"}},
+		{`{"l":[{"m":1}]}`, `{"l":[{"m":1},{"m":2}]}`, []string{"$.l[1]: added map[m:2]"}},
+		{`[1]`, `{"a":1}`, []string{"$: array [1] became object map[a:1]"}},
+	}
+	for _, test := range tests {
+		differences, err := Diff([]byte(test.a), []byte(test.b))
+		if err != nil {
+			t.Fatal(err)
+		}
+		var formatted []string
+		for _, difference := range differences {
+			formatted = append(formatted, difference.String())
+		}
+		if !reflect.DeepEqual(formatted, test.differences) {
+			t.Errorf("%s %s: differences are %q, expected %q", test.a, test.b, formatted, test.differences)
+		}
+	}
+	if _, err := Diff([]byte(`{`), []byte(`{}`)); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
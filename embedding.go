@@ -0,0 +1,69 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"math/rand"
+
+	"github.com/pointlander/anomaly/rnn"
+)
+
+// VectorTrainer computes the surprise of a unit vector with or without
+// learning from it
+type VectorTrainer interface {
+	VectorScorer
+	TrainVector(unit []float32) float32
+}
+
+// RecurrentEmbedding computes surprise with a vector engine from the states
+// of a recurrent network instead of the vectors of a Vectorizer. The
+// recurrent network learns from each document after it is embedded
+type RecurrentEmbedding struct {
+	Engine  *rnn.Engine
+	Pooling rnn.Pooling
+	Vectors VectorTrainer
+}
+
+// NewRecurrentEmbeddingFactory creates a factory for vector engines that use
+// the pooled states of a recurrent network with layers of the given cell as
+// document vectors. The vector engine must implement VectorTrainer
+func NewRecurrentEmbeddingFactory(cell rnn.Cell, options rnn.Options, pooling rnn.Pooling, vectors NetworkFactory) NetworkFactory {
+	return func(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+		engine := rnn.NewEngine(rnd, cell, options)
+		var source SourceFactory
+		if vectorizer != nil {
+			source = vectorizer.Source
+		}
+		network := vectors(rnd, NewVectorizer(engine.StateSize(), false, source))
+		trainer, ok := network.(VectorTrainer)
+		if !ok {
+			panic("vector engine doesn't implement VectorTrainer")
+		}
+		return &RecurrentEmbedding{
+			Engine:  engine,
+			Pooling: pooling,
+			Vectors: trainer,
+		}
+	}
+}
+
+// Embed computes the embedding of a document without learning
+func (r *RecurrentEmbedding) Embed(input []byte) []float32 {
+	return r.Engine.Embed(input, r.Pooling)
+}
+
+// Score computes the surprise of the embedding of a document with the vector
+// engine without learning
+func (r *RecurrentEmbedding) Score(input []byte) (surprise, uncertainty float32) {
+	return r.Vectors.ScoreVector(Normalize32(r.Embed(input))), 0
+}
+
+// Train computes the surprise of the embedding of a document with the vector
+// engine
+func (r *RecurrentEmbedding) Train(input []byte) (surprise, uncertainty float32) {
+	surprise = r.Vectors.TrainVector(Normalize32(r.Embed(input)))
+	r.Engine.Train(input)
+	return surprise, 0
+}
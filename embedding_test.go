@@ -0,0 +1,37 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"math/rand"
+	"testing"
+
+	"github.com/pointlander/anomaly/rnn"
+)
+
+// TestRecurrentEmbedding checks that scoring a document computes the surprise
+// of training on it with the vector engine
+func TestRecurrentEmbedding(t *testing.T) {
+	options := rnn.DefaultOptions()
+	options.HiddenSizes = []int{8}
+	factory := NewRecurrentEmbeddingFactory(rnn.LSTM{}, options, rnn.PoolingMean, NewAverageSimilarity)
+	embedding := factory(rand.New(rand.NewSource(1)), nil).(*RecurrentEmbedding)
+	inputs := []string{`{"a":1}`, `{"a":2}`, `{"b":"x"}`, `{"a":1}`}
+	for _, input := range inputs {
+		scored, _ := embedding.Score([]byte(input))
+		trained, _ := embedding.Train([]byte(input))
+		if scored != trained {
+			t.Errorf("%s: surprise of scoring is %v, expected %v", input, scored, trained)
+		}
+	}
+
+	root, err := Localize(embedding, []byte(`{"o":{"p":1}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if surprise, _ := embedding.Score([]byte(`{"o":{"p":1}}`)); root.Surprise != surprise {
+		t.Errorf("surprise of the root is %v, expected %v", root.Surprise, surprise)
+	}
+}
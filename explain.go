@@ -0,0 +1,96 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"sort"
+	"strings"
+)
+
+// VectorScorer computes the surprise of a unit vector without learning
+type VectorScorer interface {
+	ScoreVector(unit []float32) float32
+}
+
+// vectorNetwork is a network that scores the vectors of a Vectorizer
+type vectorNetwork interface {
+	VectorScorer
+	VectorizeContext(object map[string]interface{}, context []string) []int64
+	AddMatrixColumn(a []string, b []int64)
+}
+
+// ErrNotVectorNetwork is returned for networks that don't score document vectors
+var ErrNotVectorNetwork = errors.New("network doesn't score document vectors")
+
+// Attribution is the contribution of a path/value word to the surprise of a
+// document
+type Attribution struct {
+	Path, Value  string
+	Count        int
+	Contribution float32
+}
+
+// Explain estimates the contribution of each path/value word of a document to
+// its surprise by removing the word from the document vector and scoring the
+// remaining vector. The attributions are ranked by the magnitude of their
+// contribution
+func Explain(network Network, input []byte) ([]Attribution, error) {
+	vectors, ok := network.(vectorNetwork)
+	if !ok {
+		return nil, ErrNotVectorNetwork
+	}
+
+	var object map[string]interface{}
+	err := json.Unmarshal(input, &object)
+	if err != nil {
+		return nil, err
+	}
+	vector := vectors.VectorizeContext(object, nil)
+	surprise := vectors.ScoreVector(Normalize(vector))
+
+	var words [][]string
+	counts := make(map[string]int)
+	Words(object, func(word []string) {
+		key := strings.Join(word, "\x00")
+		if counts[key] == 0 {
+			words = append(words, append([]string(nil), word...))
+		}
+		counts[key]++
+	})
+
+	attributions := make([]Attribution, len(words))
+	column, without := make([]int64, len(vector)), make([]int64, len(vector))
+	for i, word := range words {
+		count := counts[strings.Join(word, "\x00")]
+		for j := range column {
+			column[j] = 0
+		}
+		for j := range word {
+			vectors.AddMatrixColumn(word[j:], column)
+		}
+		for j, v := range vector {
+			without[j] = v - int64(count)*column[j]
+		}
+		remaining := vectors.ScoreVector(Normalize(without))
+		if math.IsNaN(float64(remaining)) {
+			remaining = 0
+		}
+		attributions[i] = Attribution{
+			Path:         formatPath(word[:len(word)-1]),
+			Value:        word[len(word)-1],
+			Count:        count,
+			Contribution: surprise - remaining,
+		}
+	}
+
+	sort.Slice(attributions, func(i, j int) bool {
+		return math.Abs(float64(attributions[i].Contribution)) >
+			math.Abs(float64(attributions[j].Contribution))
+	})
+	return attributions, nil
+}
@@ -0,0 +1,116 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"math"
+	"testing"
+)
+
+// distanceScorer scores a vector with its cosine distance to a target vector
+type distanceScorer struct {
+	*Vectorizer
+	target []float32
+}
+
+// ScoreVector computes the cosine distance to the target vector
+func (d *distanceScorer) ScoreVector(unit []float32) float32 {
+	return float32(CosineDistance(unit, d.target))
+}
+
+// Train isn't used
+func (d *distanceScorer) Train(input []byte) (surprise, uncertainty float32) {
+	return 0, 0
+}
+
+// newDistanceScorer creates a distanceScorer with the vector of a target
+// document
+func newDistanceScorer(t *testing.T, target string) *distanceScorer {
+	d := &distanceScorer{Vectorizer: NewVectorizer(1024, true, NewLFSR32Source)}
+	d.target = d.score(t, target)
+	return d
+}
+
+// score computes the unit vector of a document
+func (d *distanceScorer) score(t *testing.T, document string) []float32 {
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(document), &object); err != nil {
+		t.Fatal(err)
+	}
+	return Normalize(d.Vectorize(object))
+}
+
+// TestExplain checks that the contribution of a word is the difference between
+// the surprise of the document with and without the word
+func TestExplain(t *testing.T) {
+	scorer := newDistanceScorer(t, `{"a":"x","b":"y"}`)
+	tests := []struct {
+		document string
+		// without are the documents without each word
+		without map[string]string
+		counts  map[string]int
+	}{
+		{
+			document: `{"a":"x","b":"y"}`,
+			without:  map[string]string{"$.a": `{"b":"y"}`, "$.b": `{"a":"x"}`},
+			counts:   map[string]int{"$.a": 1, "$.b": 1},
+		},
+		{
+			document: `{"a":"x","b":"z"}`,
+			without:  map[string]string{"$.a": `{"b":"z"}`, "$.b": `{"a":"x"}`},
+			counts:   map[string]int{"$.a": 1, "$.b": 1},
+		},
+		{
+			document: `{"a":"x","t":["w","w"]}`,
+			without:  map[string]string{"$.a": `{"t":["w","w"]}`, "$.t": `{"a":"x"}`},
+			counts:   map[string]int{"$.a": 1, "$.t": 2},
+		},
+	}
+	for _, test := range tests {
+		attributions, err := Explain(scorer, []byte(test.document))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(attributions) != len(test.without) {
+			t.Fatalf("%s: attributions are %v, expected %d", test.document, attributions, len(test.without))
+		}
+		surprise := scorer.ScoreVector(scorer.score(t, test.document))
+		for i, attribution := range attributions {
+			if count := test.counts[attribution.Path]; attribution.Count != count {
+				t.Errorf("%s: count of %s is %d, expected %d", test.document, attribution.Path,
+					attribution.Count, count)
+			}
+			contribution := surprise - scorer.ScoreVector(scorer.score(t, test.without[attribution.Path]))
+			if math.Abs(float64(attribution.Contribution-contribution)) > 1e-5 {
+				t.Errorf("%s: contribution of %s is %v, expected %v", test.document, attribution.Path,
+					attribution.Contribution, contribution)
+			}
+			if i > 0 && math.Abs(float64(attribution.Contribution)) > math.Abs(float64(attributions[i-1].Contribution)) {
+				t.Errorf("%s: attributions aren't ranked by magnitude: %v", test.document, attributions)
+			}
+		}
+	}
+
+	// removing a word from the target document makes it less like the target
+	attributions, _ := Explain(scorer, []byte(`{"a":"x","b":"y"}`))
+	for _, attribution := range attributions {
+		if attribution.Contribution >= 0 {
+			t.Errorf("contribution of %s is %v, expected a negative contribution", attribution.Path,
+				attribution.Contribution)
+		}
+	}
+	// the unseen word is the only word that adds surprise
+	attributions, _ = Explain(scorer, []byte(`{"a":"x","b":"y","c":"z"}`))
+	for _, attribution := range attributions {
+		if (attribution.Path == "$.c") != (attribution.Contribution > 0) {
+			t.Errorf("contribution of %s is %v", attribution.Path, attribution.Contribution)
+		}
+	}
+
+	if _, err := Explain(NewNovelty(nil, nil), []byte(`{}`)); err != ErrNotVectorNetwork {
+		t.Errorf("error is %v, expected %v", err, ErrNotVectorNetwork)
+	}
+}
@@ -0,0 +1,248 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// fieldWarmup is the number of documents before findings are reported
+	fieldWarmup = 16
+	// fieldSigma is the number of standard deviations for a numeric finding
+	fieldSigma = 3
+	// fieldQuantile is the tail probability for a quantile finding
+	fieldQuantile = .005
+	// fieldRare is the frequency below which a string value or type is rare
+	fieldRare = .01
+	// fieldDistinct is the rate of distinct string values above which the
+	// values of a path, such as identifiers, aren't reported
+	fieldDistinct = .5
+	// fieldPresence is the presence rate above which a missing path is reported
+	fieldPresence = .99
+	// fieldSampleSize is the size of the numeric sample used for quantiles
+	fieldSampleSize = 256
+	// fieldSketchWidth is the width of the string value sketch
+	fieldSketchWidth = 1 << 16
+	// fieldSketchDepth is the depth of the string value sketch
+	fieldSketchDepth = 4
+)
+
+// Finding is a field level explanation of surprise
+type Finding struct {
+	Path     string
+	Message  string
+	Surprise float32
+}
+
+// String formats the finding
+func (f Finding) String() string {
+	return f.Path + ": " + f.Message
+}
+
+// FieldResult is the result of field statistics for a document
+type FieldResult struct {
+	Surprise float32
+	Findings []Finding
+}
+
+// FieldStatistic are the statistics of a JSON path
+type FieldStatistic struct {
+	Present uint64
+	// Total is the number of values, an array has a value for each element
+	Total uint64
+	Types map[string]uint64
+	// Distinct is the number of distinct string values
+	Distinct uint64
+
+	// numeric values
+	Count    uint64
+	Mean, M2 float64
+	Sample   []float64
+}
+
+// Variance computes the variance of the numeric values
+func (f *FieldStatistic) Variance() float64 {
+	if f.Count < 2 {
+		return 0
+	}
+	return f.M2 / float64(f.Count-1)
+}
+
+// Quantile estimates a quantile of the numeric values
+func (f *FieldStatistic) Quantile(q float64) float64 {
+	sample := append([]float64(nil), f.Sample...)
+	sort.Float64s(sample)
+	return sample[int(q*float64(len(sample)-1)+.5)]
+}
+
+// FieldStatistics maintains statistics for each JSON path and explains the
+// surprise of a document in terms of its fields
+type FieldStatistics struct {
+	Fields    map[string]*FieldStatistic
+	Values    *CountMinSketch
+	Documents uint64
+	Rand      *rand.Rand
+}
+
+// NewFieldStatistics creates a new field statistics detector
+func NewFieldStatistics(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+	return &FieldStatistics{
+		Fields: make(map[string]*FieldStatistic),
+		Values: NewCountMinSketch(fieldSketchWidth, fieldSketchDepth),
+		Rand:   rnd,
+	}
+}
+
+func typeName(value interface{}) string {
+	switch value.(type) {
+	case string:
+		return "string"
+	case float64, json.Number:
+		return "number"
+	case bool:
+		return "bool"
+	case nil:
+		return "null"
+	}
+	return "unknown"
+}
+
+// Detect computes the field findings of a document and then learns its fields
+func (f *FieldStatistics) Detect(input []byte) *FieldResult {
+	var object map[string]interface{}
+	err := json.Unmarshal(input, &object)
+	if err != nil {
+		panic(err)
+	}
+
+	result, present, warm := &FieldResult{}, make(map[string]bool), f.Documents >= fieldWarmup
+	find := func(path string, surprise float64, format string, a ...interface{}) {
+		if !warm {
+			return
+		}
+		result.Findings = append(result.Findings, Finding{
+			Path:     path,
+			Message:  fmt.Sprintf(format, a...),
+			Surprise: float32(surprise),
+		})
+	}
+	Walk(object, func(context []string, value interface{}) {
+		path := formatPath(context)
+		field := f.Fields[path]
+		if field == nil {
+			field = &FieldStatistic{
+				Types: make(map[string]uint64),
+			}
+			f.Fields[path] = field
+			find(path, math.Log2(float64(f.Documents+1)), "path never seen")
+		}
+		if !present[path] {
+			present[path] = true
+			field.Present++
+		}
+		observed := field.Total
+		field.Total++
+
+		name := typeName(value)
+		if count := field.Types[name]; observed > 0 && float64(count) < fieldRare*float64(observed) {
+			surprise := -math.Log2(float64(count+1) / float64(observed+2))
+			if count == 0 {
+				find(path, surprise, "type %s never seen", name)
+			} else {
+				find(path, surprise, "type %s seen in %.1f%% of values", name, 100*float64(count)/float64(observed))
+			}
+		}
+		field.Types[name]++
+
+		switch value := value.(type) {
+		case string:
+			h := hashWord(append(context, value))
+			count, total := uint64(f.Values.Count(h)), field.Types[name]-1
+			distinct := float64(field.Distinct) > fieldDistinct*float64(total)
+			if total > 0 && !distinct && float64(count) < fieldRare*float64(total) {
+				surprise := -math.Log2(float64(count+1) / float64(total+2))
+				if count == 0 {
+					find(path, surprise, "value %q never seen", value)
+				} else {
+					find(path, surprise, "value %q seen in %.1f%% of values", value, 100*float64(count)/float64(total))
+				}
+			}
+			if count == 0 {
+				field.Distinct++
+			}
+			f.Values.Add(h)
+		case float64:
+			f.number(path, field, value, find)
+		case json.Number:
+			if x, err := value.Float64(); err == nil {
+				f.number(path, field, x, find)
+			}
+		}
+	})
+
+	if warm {
+		for path, field := range f.Fields {
+			rate := float64(field.Present) / float64(f.Documents)
+			if present[path] || rate < fieldPresence {
+				continue
+			}
+			find(path, -math.Log2(1-float64(field.Present)/float64(f.Documents+1)),
+				"missing, present in %.1f%% of documents", 100*rate)
+		}
+	}
+	f.Documents++
+
+	sort.Slice(result.Findings, func(i, j int) bool {
+		return result.Findings[i].Surprise > result.Findings[j].Surprise
+	})
+	for _, finding := range result.Findings {
+		result.Surprise += finding.Surprise
+	}
+	return result
+}
+
+// number checks and then learns a numeric value
+func (f *FieldStatistics) number(path string, field *FieldStatistic, value float64,
+	find func(path string, surprise float64, format string, a ...interface{})) {
+	if stddev := math.Sqrt(field.Variance()); stddev > 0 {
+		z := (value - field.Mean) / stddev
+		if math.Abs(z) >= fieldSigma {
+			direction := "above"
+			if z < 0 {
+				direction = "below"
+			}
+			find(path, z*z/(2*math.Ln2), "%.1fσ %s mean", math.Abs(z), direction)
+		} else if len(field.Sample) >= fieldSampleSize/2 {
+			if low := field.Quantile(fieldQuantile); value < low {
+				find(path, -math.Log2(fieldQuantile), "%g below %g quantile %g", value, fieldQuantile, low)
+			} else if high := field.Quantile(1 - fieldQuantile); value > high {
+				find(path, -math.Log2(fieldQuantile), "%g above %g quantile %g", value, 1-fieldQuantile, high)
+			}
+		}
+	}
+
+	// https://en.wikipedia.org/wiki/Algorithms_for_calculating_variance#Welford's_online_algorithm
+	field.Count++
+	delta := value - field.Mean
+	field.Mean += delta / float64(field.Count)
+	field.M2 += delta * (value - field.Mean)
+
+	// https://en.wikipedia.org/wiki/Reservoir_sampling
+	if len(field.Sample) < fieldSampleSize {
+		field.Sample = append(field.Sample, value)
+	} else if j := f.Rand.Int63n(int64(field.Count)); j < fieldSampleSize {
+		field.Sample[j] = value
+	}
+}
+
+// Train computes the surprise with field statistics
+func (f *FieldStatistics) Train(input []byte) (surprise, uncertainty float32) {
+	return f.Detect(input).Surprise, 0
+}
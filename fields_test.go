@@ -0,0 +1,135 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// repeat repeats a document
+func repeat(document string, count int) []string {
+	documents := make([]string, count)
+	for i := range documents {
+		documents[i] = document
+	}
+	return documents
+}
+
+// distinct formats a document with each of count numbers
+func distinct(format string, count int) []string {
+	documents := make([]string, count)
+	for i := range documents {
+		documents[i] = fmt.Sprintf(format, i)
+	}
+	return documents
+}
+
+// TestFieldStatistics checks the findings of a document after learning from
+// other documents
+func TestFieldStatistics(t *testing.T) {
+	tests := []struct {
+		name      string
+		documents []string
+		document  string
+		findings  []Finding
+	}{
+		{
+			name:      "normal",
+			documents: repeat(`{"a":"x","b":2}`, fieldWarmup),
+			document:  `{"a":"x","b":2}`,
+		},
+		{
+			name:      "warmup",
+			documents: repeat(`{"a":"x"}`, fieldWarmup-1),
+			document:  `{"a":1}`,
+		},
+		{
+			name:      "new path",
+			documents: repeat(`{"a":"x"}`, fieldWarmup),
+			document:  `{"a":"x","c":"y"}`,
+			findings:  []Finding{{"$.c", "path never seen", float32(math.Log2(17))}},
+		},
+		{
+			name:      "new type",
+			documents: repeat(`{"a":"x"}`, fieldWarmup),
+			document:  `{"a":1}`,
+			findings:  []Finding{{"$.a", "type number never seen", float32(math.Log2(18))}},
+		},
+		{
+			name:      "new value",
+			documents: repeat(`{"a":"x"}`, fieldWarmup),
+			document:  `{"a":"y"}`,
+			findings:  []Finding{{"$.a", `value "y" never seen`, float32(math.Log2(18))}},
+		},
+		{
+			// the values of a path that are mostly distinct aren't reported
+			name:      "high cardinality",
+			documents: distinct(`{"id":"%d","a":"x"}`, fieldWarmup),
+			document:  `{"id":"new","a":"x"}`,
+		},
+		{
+			// the path and value of $.a have the same concatenation as the
+			// path and value of $.ax
+			name:      "collision",
+			documents: repeat(`{"a":"xy","ax":"z"}`, fieldWarmup),
+			document:  `{"a":"xy","ax":"y"}`,
+			findings:  []Finding{{"$.ax", `value "y" never seen`, float32(math.Log2(18))}},
+		},
+		{
+			name:      "missing",
+			documents: repeat(`{"a":"x","b":"z"}`, fieldWarmup),
+			document:  `{"a":"x"}`,
+			findings:  []Finding{{"$.b", "missing, present in 100.0% of documents", float32(math.Log2(17))}},
+		},
+		{
+			name:      "outlier",
+			documents: append(repeat(`{"a":1}`, fieldWarmup/2), repeat(`{"a":3}`, fieldWarmup/2)...),
+			document:  `{"a":10}`,
+			findings:  []Finding{{"$.a", "7.7σ above mean", float32(60 / (2 * math.Ln2))}},
+		},
+		{
+			name:      "quantile",
+			documents: append(repeat(`{"a":0}`, fieldSampleSize/2), repeat(`{"a":100}`, fieldSampleSize/2)...),
+			document:  `{"a":150}`,
+			findings:  []Finding{{"$.a", "150 above 0.995 quantile 100", float32(-math.Log2(fieldQuantile))}},
+		},
+		{
+			// the rate of a type is of the values of an array, not of the
+			// documents
+			name: "array type",
+			documents: append([]string{`{"t":[1,"b","c","d","e","f","g","h","i","j"]}`},
+				repeat(`{"t":["a","b","c","d","e","f","g","h","i","j"]}`, fieldWarmup-1)...),
+			document: `{"t":[2]}`,
+			findings: []Finding{{"$.t", "type number seen in 0.6% of values", float32(math.Log2(81))}},
+		},
+	}
+	for _, test := range tests {
+		fields := NewFieldStatistics(rand.New(rand.NewSource(1)), nil).(*FieldStatistics)
+		for _, document := range test.documents {
+			fields.Detect([]byte(document))
+		}
+		result := fields.Detect([]byte(test.document))
+		if len(result.Findings) != len(test.findings) {
+			t.Errorf("%s: findings are %v, expected %v", test.name, result.Findings, test.findings)
+			continue
+		}
+		sum := float32(0)
+		for i, finding := range result.Findings {
+			expected := test.findings[i]
+			if finding.Path != expected.Path || finding.Message != expected.Message ||
+				math.Abs(float64(finding.Surprise-expected.Surprise)) > 1e-4 {
+				t.Errorf("%s: finding is %v %v, expected %v %v", test.name,
+					finding, finding.Surprise, expected, expected.Surprise)
+			}
+			sum += finding.Surprise
+		}
+		if result.Surprise != sum {
+			t.Errorf("%s: surprise is %v, expected %v", test.name, result.Surprise, sum)
+		}
+	}
+}
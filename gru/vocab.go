@@ -1,60 +1,40 @@
 package gru
 
+import (
+	"github.com/pointlander/anomaly/rnn"
+)
+
 const (
 	// START is the start symbol
-	START rune = 0x02
+	START = rnn.START
 	// END is the end symbol
-	END rune = 0x03
+	END = rnn.END
+	// UNKNOWN is the symbol of runes that aren't in a vocabulary
+	UNKNOWN = rnn.UNKNOWN
 )
 
 // Vocabulary maps between runes and ints
-type Vocabulary struct {
-	List  []rune
-	Index map[rune]int
-}
+type Vocabulary = rnn.Vocabulary
 
 // NewVocabulary create a new vocabulary list
 func NewVocabulary(ss [][]rune, thresh int) *Vocabulary {
-	dict := make(map[rune]int)
-	for _, s := range ss {
-		for _, r := range s {
-			dict[r]++
-		}
-	}
-
-	list, index := []rune{START}, make(map[rune]int)
-
-	for ch, c := range dict {
-		if c >= thresh && ch != START && ch != END {
-			// then add letter to vocab
-			list = append(list, ch)
-		}
-	}
-
-	list = append(list, END)
-
-	for i, v := range list {
-		index[v] = i
-	}
-
-	return &Vocabulary{
-		List:  list,
-		Index: index,
-	}
+	return rnn.NewVocabulary(ss, thresh)
 }
 
 // NewVocabularyFromRange create a new vocabulary list using a range
 func NewVocabularyFromRange(start, stop rune) *Vocabulary {
-	list, index := make([]rune, 0), make(map[rune]int)
-	for i := start; i < stop; i++ {
-		list = append(list, i)
-	}
-	for i, v := range list {
-		index[v] = i
-	}
-
-	return &Vocabulary{
-		List:  list,
-		Index: index,
-	}
+	return rnn.NewVocabularyFromRange(start, stop)
+}
+
+// Tokenizer splits documents into symbols
+type Tokenizer = rnn.Tokenizer
+
+// NewRuneTokenizer creates a tokenizer with the most frequent runes of a corpus
+func NewRuneTokenizer(corpus [][]byte, size int) *rnn.RuneTokenizer {
+	return rnn.NewRuneTokenizer(corpus, size)
+}
+
+// NewBPETokenizer creates a tokenizer with subwords learned from a corpus
+func NewBPETokenizer(corpus [][]byte, size, merges int) *rnn.BPETokenizer {
+	return rnn.NewBPETokenizer(corpus, size, merges)
 }
@@ -0,0 +1,108 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+)
+
+// Scorer computes the surprise of an input without learning
+type Scorer interface {
+	Score(input []byte) (surprise, uncertainty float32)
+}
+
+// ErrNotScorer is returned for networks that can't score without learning
+var ErrNotScorer = errors.New("network can't score without learning")
+
+// Subtree is an object subtree of a JSON document annotated with its surprise
+type Subtree struct {
+	Path                  string
+	Surprise, Uncertainty float32
+	Children              []*Subtree
+}
+
+// Localize scores every object subtree of a JSON document independently
+// without learning. Vector engines score the vector of the subtree within the
+// context of its parent keys, other engines score the serialized subtree.
+// For vector engines a subtree without path/value words of its own, such as an
+// object that only holds objects, has a surprise of 0
+func Localize(network Network, input []byte) (*Subtree, error) {
+	var score func(object map[string]interface{}, context []string) (surprise, uncertainty float32, err error)
+	switch network := network.(type) {
+	case vectorNetwork:
+		score = func(object map[string]interface{}, context []string) (float32, float32, error) {
+			vector := network.VectorizeContext(object, context)
+			for _, v := range vector {
+				if v != 0 {
+					return network.ScoreVector(Normalize(vector)), 0, nil
+				}
+			}
+			// a subtree without path/value words of its own isn't surprising
+			return 0, 0, nil
+		}
+	case Scorer:
+		score = func(object map[string]interface{}, context []string) (float32, float32, error) {
+			data, err := json.Marshal(object)
+			if err != nil {
+				return 0, 0, err
+			}
+			surprise, uncertainty := network.Score(data)
+			return surprise, uncertainty, nil
+		}
+	default:
+		return nil, ErrNotScorer
+	}
+
+	var object map[string]interface{}
+	err := json.Unmarshal(input, &object)
+	if err != nil {
+		return nil, err
+	}
+
+	var process func(object map[string]interface{}, path string, context []string) (*Subtree, error)
+	process = func(object map[string]interface{}, path string, context []string) (*Subtree, error) {
+		surprise, uncertainty, err := score(object, context)
+		if err != nil {
+			return nil, err
+		}
+		subtree := &Subtree{
+			Path:        path,
+			Surprise:    surprise,
+			Uncertainty: uncertainty,
+		}
+
+		keys := make([]string, 0, len(object))
+		for key := range object {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			sub := append(context[:len(context):len(context)], key)
+			switch value := object[key].(type) {
+			case map[string]interface{}:
+				child, err := process(value, path+"."+key, sub)
+				if err != nil {
+					return nil, err
+				}
+				subtree.Children = append(subtree.Children, child)
+			case []interface{}:
+				for i, value := range value {
+					if value, ok := value.(map[string]interface{}); ok {
+						child, err := process(value, fmt.Sprintf("%s.%s[%d]", path, key, i), sub)
+						if err != nil {
+							return nil, err
+						}
+						subtree.Children = append(subtree.Children, child)
+					}
+				}
+			}
+		}
+		return subtree, nil
+	}
+	return process(object, "$", nil)
+}
@@ -0,0 +1,107 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"math"
+	"testing"
+)
+
+// lengthScorer scores an input with its length
+type lengthScorer struct{}
+
+// Score computes the length of the input
+func (lengthScorer) Score(input []byte) (surprise, uncertainty float32) {
+	return float32(len(input)), 1
+}
+
+// Train computes the length of the input
+func (lengthScorer) Train(input []byte) (surprise, uncertainty float32) {
+	return float32(len(input)), 1
+}
+
+// flatten lists the subtrees of a tree depth first
+func flatten(subtree *Subtree) []*Subtree {
+	subtrees := []*Subtree{subtree}
+	for _, child := range subtree.Children {
+		subtrees = append(subtrees, flatten(child)...)
+	}
+	return subtrees
+}
+
+// TestLocalize checks the surprise of the object subtrees of a document
+func TestLocalize(t *testing.T) {
+	document := `{"a":1,"o":{"p":"x","q":{"r":"y"}},"l":[{"m":"z"},2]}`
+	paths := []string{"$", "$.l[0]", "$.o", "$.o.q"}
+
+	// scorers score the serialized subtrees
+	texts := []string{
+		`{"a":1,"l":[{"m":"z"},2],"o":{"p":"x","q":{"r":"y"}}}`,
+		`{"m":"z"}`,
+		`{"p":"x","q":{"r":"y"}}`,
+		`{"r":"y"}`,
+	}
+	root, err := Localize(lengthScorer{}, []byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subtrees := flatten(root)
+	if len(subtrees) != len(paths) {
+		t.Fatalf("%d subtrees, expected %d", len(subtrees), len(paths))
+	}
+	for i, subtree := range subtrees {
+		if subtree.Path != paths[i] || subtree.Surprise != float32(len(texts[i])) || subtree.Uncertainty != 1 {
+			t.Errorf("subtree is %s %v %v, expected %s %v 1", subtree.Path, subtree.Surprise,
+				subtree.Uncertainty, paths[i], len(texts[i]))
+		}
+	}
+
+	// vector engines score the vectors of the subtrees within the context of
+	// their parent keys
+	scorer := newDistanceScorer(t, `{"o":[{"p":"x"}]}`)
+	contexts := []string{
+		document,
+		`{"l":[{"m":"z"}]}`,
+		`{"o":[{"p":"x","q":{"r":"y"}}]}`,
+		`{"o":[{"q":[{"r":"y"}]}]}`,
+	}
+	root, err = Localize(scorer, []byte(document))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, subtree := range flatten(root) {
+		surprise := scorer.ScoreVector(scorer.score(t, contexts[i]))
+		if subtree.Path != paths[i] || math.Abs(float64(subtree.Surprise-surprise)) > 1e-6 {
+			t.Errorf("subtree is %s %v, expected %s %v", subtree.Path, subtree.Surprise, paths[i], surprise)
+		}
+	}
+	// the subtree that is the target isn't surprising
+	if surprise := flatten(root)[2].Surprise; surprise > 1e-6 {
+		t.Errorf("surprise of $.o is %v, expected 0", surprise)
+	}
+
+	// the top level only holds an object, so it has no words of its own
+	root, err = Localize(scorer, []byte(`{"o":{"p":"x"}}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	subtrees = flatten(root)
+	if len(subtrees) != 2 {
+		t.Fatalf("%d subtrees, expected 2", len(subtrees))
+	}
+	if subtrees[0].Surprise != 0 {
+		t.Errorf("surprise of $ is %v, expected 0", subtrees[0].Surprise)
+	}
+	if subtrees[1].Path != "$.o" || math.IsNaN(float64(subtrees[1].Surprise)) {
+		t.Errorf("subtree is %s %v, expected $.o", subtrees[1].Path, subtrees[1].Surprise)
+	}
+
+	if _, err := Localize(NewNovelty(nil, nil), []byte(document)); err != ErrNotScorer {
+		t.Errorf("error is %v, expected %v", err, ErrNotScorer)
+	}
+	if _, err := Localize(lengthScorer{}, []byte(`{`)); err == nil {
+		t.Error("expected an error for invalid JSON")
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+)
+
+const (
+	// lofReservoirSize is the maximum number of vectors held by LOF
+	lofReservoirSize = 1024
+	// lofK is the default neighborhood size of LOF
+	lofK = 10
+)
+
+// Distance computes the distance between two vectors
+type Distance func(a, b []float32) float64
+
+// CosineDistance computes the cosine distance between two vectors
+func CosineDistance(a, b []float32) float64 {
+	distance := 1 - Similarity(a, b)
+	if distance < 0 || math.IsNaN(distance) {
+		return 0
+	}
+	return distance
+}
+
+// EuclideanDistance computes the euclidean distance between two vectors
+func EuclideanDistance(a, b []float32) float64 {
+	sum := 0.0
+	for i, j := range b {
+		d := float64(a[i]) - float64(j)
+		sum += d * d
+	}
+	return math.Sqrt(sum)
+}
+
+// LOF computes surprise with the local outlier factor of a document vector
+// relative to a reservoir sample of previous document vectors
+// https://en.wikipedia.org/wiki/Local_outlier_factor
+type LOF struct {
+	K         int
+	Distance  Distance
+	vectors   [][]float32
+	distances [][]float32
+	seen      int
+	rnd       *rand.Rand
+	*Vectorizer
+}
+
+// NewLOF creates a new local outlier factor surprise engine using cosine distance
+func NewLOF(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+	return NewLOFFactory(lofK, CosineDistance)(rnd, vectorizer)
+}
+
+// NewLOFFactory creates a factory for local outlier factor surprise engines
+// with neighborhood size k and the given distance, k is at least 1
+func NewLOFFactory(k int, distance Distance) NetworkFactory {
+	if k < 1 {
+		k = 1
+	}
+	return func(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+		return &LOF{
+			K:          k,
+			Distance:   distance,
+			vectors:    make([][]float32, 0, lofReservoirSize),
+			distances:  make([][]float32, 0, lofReservoirSize),
+			rnd:        rnd,
+			Vectorizer: vectorizer,
+		}
+	}
+}
+
+// neighbors finds the k nearest neighbors given the distances to all vectors
+func (l *LOF) neighbors(distances []float32, exclude int) []int {
+	k := l.K
+	nearest := make([]int, 0, k+1)
+	for i, d := range distances {
+		if i == exclude {
+			continue
+		}
+		if len(nearest) == k && d >= distances[nearest[k-1]] {
+			continue
+		}
+		j := len(nearest)
+		if j < k {
+			nearest = append(nearest, i)
+		} else {
+			j = k - 1
+		}
+		for j > 0 && distances[nearest[j-1]] > d {
+			nearest[j] = nearest[j-1]
+			j--
+		}
+		nearest[j] = i
+	}
+	return nearest
+}
+
+// distancesTo computes the distances from a unit vector to all vectors
+func (l *LOF) distancesTo(unit []float32) []float32 {
+	distances := make([]float32, len(l.vectors))
+	for i, v := range l.vectors {
+		distances[i] = float32(l.Distance(unit, v))
+	}
+	return distances
+}
+
+// ScoreVector computes the local outlier factor of a unit vector
+func (l *LOF) ScoreVector(unit []float32) float32 {
+	if len(l.vectors) <= l.K {
+		return 0
+	}
+	return l.factor(l.distancesTo(unit))
+}
+
+// Train computes the surprise with the local outlier factor
+func (l *LOF) Train(input []byte) (surprise, uncertainty float32) {
+	var object map[string]interface{}
+	err := json.Unmarshal(input, &object)
+	if err != nil {
+		panic(err)
+	}
+	vector := l.Vectorizer.Vectorize(object)
+	return l.TrainVector(Normalize(vector)), 0
+}
+
+// TrainVector computes the local outlier factor of a unit vector and adds it
+// to the reservoir
+func (l *LOF) TrainVector(unit []float32) (surprise float32) {
+	distances := l.distancesTo(unit)
+	if len(l.vectors) > l.K {
+		surprise = l.factor(distances)
+	}
+
+	l.seen++
+	if length := len(l.vectors); length < lofReservoirSize {
+		l.vectors = append(l.vectors, unit)
+		l.distances = append(l.distances, append(distances, 0))
+		for i := 0; i < length; i++ {
+			l.distances[i] = append(l.distances[i], distances[i])
+		}
+	} else if j := l.rnd.Intn(l.seen); j < lofReservoirSize {
+		l.vectors[j] = unit
+		for i, d := range distances {
+			l.distances[i][j], l.distances[j][i] = d, d
+		}
+		l.distances[j][j] = 0
+	}
+
+	return surprise
+}
+
+// factor computes the local outlier factor given the distances to all vectors
+func (l *LOF) factor(distances []float32) float32 {
+	kDistances := make(map[int]float32)
+	kDistance := func(i int) float32 {
+		d, found := kDistances[i]
+		if !found {
+			nearest := l.neighbors(l.distances[i], i)
+			d = l.distances[i][nearest[len(nearest)-1]]
+			kDistances[i] = d
+		}
+		return d
+	}
+	density := func(distances []float32, nearest []int) float64 {
+		sum := 0.0
+		for _, o := range nearest {
+			reach := kDistance(o)
+			if d := distances[o]; d > reach {
+				reach = d
+			}
+			sum += float64(reach)
+		}
+		return float64(len(nearest)) / (sum + 1e-9)
+	}
+
+	nearest := l.neighbors(distances, -1)
+	sum := 0.0
+	for _, o := range nearest {
+		sum += density(l.distances[o], l.neighbors(l.distances[o], o))
+	}
+	return float32(sum / float64(len(nearest)) / density(distances, nearest))
+}
@@ -0,0 +1,66 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestLOF checks the local outlier factor of points on a line
+func TestLOF(t *testing.T) {
+	tests := []struct {
+		name     string
+		k        int
+		points   []float32
+		point    float32
+		surprise float32
+	}{
+		{"too few", 2, []float32{0, 1}, 10, 0},
+		{"inlier", 1, []float32{0, 1, 2}, 1, 1},
+		{"outlier", 1, []float32{0, 1, 2}, 10, 8},
+		{"zero k", 0, []float32{0, 1, 2}, 10, 8},
+		{"negative k", -3, []float32{0, 1, 2}, 10, 8},
+		{"wider neighborhood", 2, []float32{0, 1, 2, 3}, 7, 3},
+	}
+	for _, test := range tests {
+		lof := NewLOFFactory(test.k, EuclideanDistance)(rand.New(rand.NewSource(1)), nil).(*LOF)
+		for _, point := range test.points {
+			lof.TrainVector([]float32{point})
+		}
+		surprise := lof.ScoreVector([]float32{test.point})
+		if math.Abs(float64(surprise-test.surprise)) > 1e-4 {
+			t.Errorf("%s: surprise is %v, expected %v", test.name, surprise, test.surprise)
+		}
+		if trained := lof.TrainVector([]float32{test.point}); trained != surprise {
+			t.Errorf("%s: surprise of training is %v, expected %v", test.name, trained, surprise)
+		}
+	}
+}
+
+// TestLOFDocuments checks that a document unlike the others has a higher local
+// outlier factor than a document like the others
+func TestLOFDocuments(t *testing.T) {
+	rnd := rand.New(rand.NewSource(1))
+	lof := NewLOFFactory(3, CosineDistance)(rnd, NewVectorizer(1024, true, NewLFSR32Source)).(*LOF)
+	for i := 0; i < 20; i++ {
+		lof.Train([]byte(`{"user":"alice","action":"login","ok":true}`))
+		lof.Train([]byte(`{"user":"bob","action":"logout","ok":true}`))
+	}
+	score := func(document string) float32 {
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(document), &object); err != nil {
+			t.Fatal(err)
+		}
+		return lof.ScoreVector(Normalize(lof.Vectorize(object)))
+	}
+	normal := score(`{"user":"alice","action":"logout","ok":true}`)
+	outlier := score(`{"disk":{"free":12,"total":100},"alarm":"full"}`)
+	if !(outlier > normal) {
+		t.Errorf("outlier surprise %v isn't greater than normal surprise %v", outlier, normal)
+	}
+}
@@ -0,0 +1,25 @@
+package lstm
+
+import (
+	"github.com/pointlander/anomaly/rnn"
+)
+
+// Solver is a type of solver for learning
+type Solver = rnn.Solver
+
+const (
+	// SolverRMSProp is the RMSProp solver
+	SolverRMSProp = rnn.SolverRMSProp
+	// SolverAdam is the Adam solver
+	SolverAdam = rnn.SolverAdam
+	// SolverMomentum is stochastic gradient descent with momentum
+	SolverMomentum = rnn.SolverMomentum
+)
+
+// Options are the hyperparameters of the LSTM
+type Options = rnn.Options
+
+// DefaultOptions returns the default hyperparameters of the LSTM
+func DefaultOptions() Options {
+	return rnn.DefaultOptions()
+}
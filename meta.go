@@ -6,7 +6,6 @@ package anomaly
 
 import (
 	"math"
-	"math/bits"
 	"math/rand"
 )
 
@@ -28,23 +27,54 @@ func NewMeta(rnd *rand.Rand, vectorizer *Vectorizer) Network {
 	}
 }
 
+// Nodes is the number of nodes in the context trees of the models
+func (m *Meta) Nodes() int {
+	nodes := 0
+	for _, model := range m.Models {
+		nodes += model.Nodes()
+	}
+	return nodes
+}
+
+// Profile computes the surprise of each byte of the input averaged across models
+func (m *Meta) Profile(input []byte) []float32 {
+	average := make([]float32, len(input))
+	for _, model := range m.Models {
+		for i, cost := range profile(model, input) {
+			average[i] += cost
+		}
+	}
+	for i := range average {
+		average[i] /= float32(len(m.Models))
+	}
+	return average
+}
+
+// Score computes the surprise with the meta engine without learning
+func (m *Meta) Score(input []byte) (surprise, uncertainty float32) {
+	return m.score(input, false)
+}
+
 // Train trains the meta engine
 func (m *Meta) Train(input []byte) (surprise, uncertainty float32) {
+	return m.score(input, true)
+}
+
+// score computes the surprise with the meta engine and optionally trains a
+// random subset of the models
+func (m *Meta) score(input []byte, learn bool) (surprise, uncertainty float32) {
 	sum, sumSquared := 0.0, 0.0
 	for _, model := range m.Models {
-		var total uint64
-		for _, s := range input {
-			cdf := model.Model()
-			total += uint64(bits.Len16(cdf[s+1] - cdf[s]))
-			model.AddContext(uint16(s))
+		var total float64
+		for _, cost := range profile(model, input) {
+			total += float64(cost)
 		}
-		model.ResetContext()
 
-		sample := float64(CDF16Fixed+1) - (float64(total) / float64(len(input)))
+		sample := total / float64(len(input))
 		sum += sample
 		sumSquared += sample * sample
 
-		if m.Rand.Intn(2) == 0 {
+		if learn && m.Rand.Intn(2) == 0 {
 			for _, s := range input {
 				model.Update(uint16(s))
 			}
@@ -0,0 +1,109 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"math"
+	"time"
+)
+
+// ExponentialBuckets creates count bucket bounds starting at start, each
+// bound is factor times the previous bound
+func ExponentialBuckets(start, factor float64, count int) []float64 {
+	bounds := make([]float64, count)
+	for i := range bounds {
+		bounds[i] = start
+		start *= factor
+	}
+	return bounds
+}
+
+// SurpriseBuckets are the bounds of the surprise histograms, the engines have
+// surprises from fractions of a bit to thousands of nats
+var SurpriseBuckets = ExponentialBuckets(0.01, 4, 11)
+
+// LatencyBuckets are the bounds of the latency histograms in seconds
+var LatencyBuckets = ExponentialBuckets(0.0001, 4, 10)
+
+// Histogram counts observations in buckets
+type Histogram struct {
+	// Bounds are the upper bounds of the buckets
+	Bounds []float64
+	// Counts are the number of observations in each bucket, the last count is
+	// of the observations above the last bound
+	Counts []uint64
+	Sum    float64
+	Count  uint64
+}
+
+// NewHistogram creates a histogram with the given bucket bounds
+func NewHistogram(bounds []float64) *Histogram {
+	return &Histogram{
+		Bounds: bounds,
+		Counts: make([]uint64, len(bounds)+1),
+	}
+}
+
+// Observe adds an observation to the histogram, NaN isn't counted
+func (h *Histogram) Observe(value float64) {
+	if math.IsNaN(value) {
+		return
+	}
+	i := 0
+	for i < len(h.Bounds) && value > h.Bounds[i] {
+		i++
+	}
+	h.Counts[i]++
+	h.Sum += value
+	h.Count++
+}
+
+// Metrics are the metrics of a detector
+type Metrics struct {
+	// Trained and Scored count the documents learned from and scored without
+	// learning
+	Trained, Scored uint64
+	// Errors counts the documents that couldn't be processed
+	Errors uint64
+	// Alerts counts the documents with a z-score at or beyond the threshold
+	// of the detector
+	Alerts uint64
+	// Surprise is the histogram of the surprise of the documents
+	Surprise *Histogram
+	// TrainLatency and ScoreLatency are the histograms of the seconds taken
+	// to process a document
+	TrainLatency, ScoreLatency *Histogram
+}
+
+// NewMetrics creates metrics with the default buckets
+func NewMetrics() *Metrics {
+	return &Metrics{
+		Surprise:     NewHistogram(SurpriseBuckets),
+		TrainLatency: NewHistogram(LatencyBuckets),
+		ScoreLatency: NewHistogram(LatencyBuckets),
+	}
+}
+
+// observe adds a processed document to the metrics
+func (m *Metrics) observe(result Result, learn bool, elapsed time.Duration) {
+	latency := m.ScoreLatency
+	if learn {
+		m.Trained++
+		latency = m.TrainLatency
+	} else {
+		m.Scored++
+	}
+	if result.Alert {
+		m.Alerts++
+	}
+	m.Surprise.Observe(float64(result.Surprise))
+	latency.Observe(elapsed.Seconds())
+}
+
+// ContextTree is a network with context trees, such as the Complexity and
+// meta engines
+type ContextTree interface {
+	Nodes() int
+}
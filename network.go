@@ -7,8 +7,10 @@ package anomaly
 import (
 	"math/rand"
 
+	"github.com/pointlander/anomaly/attention"
 	"github.com/pointlander/anomaly/gru"
 	"github.com/pointlander/anomaly/lstm"
+	"github.com/pointlander/anomaly/rnn"
 )
 
 // Network is a network for calculating surprise
@@ -28,3 +30,48 @@ func NewLSTM(rnd *rand.Rand, vectorizer *Vectorizer) Network {
 func NewGRU(rnd *rand.Rand, vectorizer *Vectorizer) Network {
 	return gru.NewGRU(rnd)
 }
+
+// NewAttention creates a new attention network
+func NewAttention(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+	return attention.NewAttention(rnd)
+}
+
+// NewLSTMFactory creates a factory for LSTM networks with the given
+// hyperparameters
+func NewLSTMFactory(options lstm.Options) NetworkFactory {
+	return func(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+		return lstm.NewLSTMWithOptions(rnd, options)
+	}
+}
+
+// NewGRUFactory creates a factory for GRU networks with the given
+// hyperparameters
+func NewGRUFactory(options gru.Options) NetworkFactory {
+	return func(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+		return gru.NewGRUWithOptions(rnd, options)
+	}
+}
+
+// NewBidirectionalFactory creates a factory for bidirectional recurrent
+// networks with layers of the given cell and the given hyperparameters
+func NewBidirectionalFactory(cell rnn.Cell, options rnn.Options) NetworkFactory {
+	return func(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+		return rnn.NewBidirectional(rnd, cell, options)
+	}
+}
+
+// NewAttentionFactory creates a factory for attention networks with the given
+// hyperparameters
+func NewAttentionFactory(options attention.Options) NetworkFactory {
+	return func(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+		return attention.NewAttentionWithOptions(rnd, options)
+	}
+}
+
+// NewRNNFactory creates a factory for recurrent networks with layers of the
+// given cell and the given hyperparameters
+func NewRNNFactory(cell rnn.Cell, options rnn.Options) NetworkFactory {
+	return func(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+		return rnn.NewEngine(rnd, cell, options)
+	}
+}
@@ -8,62 +8,91 @@ import (
 	"encoding/json"
 	"math"
 	"math/rand"
-
-	gg "gorgonia.org/gorgonia"
-	"gorgonia.org/tensor"
 )
 
-// Neuron is a single neuron
+// NeuronOptions are the hyperparameters of a bank of neurons
+type NeuronOptions struct {
+	// Prototypes is the number of competing neurons, each neuron learns the
+	// direction of a mode of the vectors
+	Prototypes int
+	LearnRate  float32
+}
+
+// DefaultNeuronOptions returns the default hyperparameters of a neuron
+func DefaultNeuronOptions() NeuronOptions {
+	return NeuronOptions{
+		Prototypes: 1,
+		LearnRate:  0.5,
+	}
+}
+
+// Neuron is a bank of competing neurons, only the neuron most similar to a
+// vector learns from it
+// https://en.wikipedia.org/wiki/Competitive_learning
 type Neuron struct {
-	I, W *tensor.Dense
-	CS   *gg.Node
-	*gg.ExprGraph
-	gg.VM
-	gg.Nodes
-	*gg.VanillaSolver
+	NeuronOptions
+	// Weights are the weights of the neurons
+	Weights [][]float32
+	// active is the number of neurons that have been seeded
+	active int
 	*Vectorizer
 }
 
 // NewNeuron creates a new neuron
 func NewNeuron(rnd *rand.Rand, vectorizer *Vectorizer) Network {
-	width := vectorizer.Size
-	ii := tensor.NewDense(tensor.Float32, tensor.Shape{width})
-	ww := tensor.NewDense(tensor.Float32, tensor.Shape{width})
+	return NewNeuronFactory(DefaultNeuronOptions())(rnd, vectorizer)
+}
 
-	random32 := func(a, b float32) float32 {
-		return (b-a)*rnd.Float32() + a
+// NewNeuronFactory creates a factory for banks of neurons with the given
+// hyperparameters
+func NewNeuronFactory(options NeuronOptions) NetworkFactory {
+	return func(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+		if options.Prototypes < 1 {
+			options.Prototypes = 1
+		}
+		width := vectorizer.Size
+		random32 := func(a, b float32) float32 {
+			return (b-a)*rnd.Float32() + a
+		}
+		fanIn := float32(math.Sqrt(float64(width)))
+		weights := make([][]float32, options.Prototypes)
+		for i := range weights {
+			weights[i] = make([]float32, width)
+			for j := range weights[i] {
+				weights[i][j] = random32(-1, 1) / fanIn
+			}
+		}
+		// a single neuron learns from its random weights, a bank of neurons is
+		// seeded with the first vectors so that every neuron can win
+		active := 0
+		if options.Prototypes == 1 {
+			active = 1
+		}
+		return &Neuron{
+			NeuronOptions: options,
+			Weights:       weights,
+			active:        active,
+			Vectorizer:    vectorizer,
+		}
 	}
-	fanIn := float32(math.Sqrt(float64(width)))
-	for i := 0; i < width; i++ {
-		ww.SetAt(random32(-1, 1)/fanIn, i)
-	}
-
-	g := gg.NewGraph()
-	i := gg.NewVector(g, tensor.Float32, gg.WithShape(width), gg.WithName("i"), gg.WithValue(ii))
-	w := gg.NewVector(g, tensor.Float32, gg.WithShape(width), gg.WithName("w"), gg.WithValue(ww))
-	iw := gg.Must(gg.Mul(i, w))
-	mi := gg.Must(gg.Sqrt(gg.Must(gg.Sum(gg.Must(gg.Square(i))))))
-	mw := gg.Must(gg.Sqrt(gg.Must(gg.Sum(gg.Must(gg.Square(w))))))
-	cs := gg.Must(gg.Div(iw, gg.Must(gg.Mul(mi, mw))))
-
-	one := gg.NewScalar(g, tensor.Float32, gg.WithValue(float32(1.0)))
-	cost := gg.Must(gg.Square(gg.Must(gg.Sub(one, cs))))
+}
 
-	_, err := gg.Grad(cost, w)
-	if err != nil {
-		panic(err)
+// best finds the active neuron most similar to a unit vector
+func (n *Neuron) best(unit []float32) (index int, similarity float64) {
+	for i, weights := range n.Weights[:n.active] {
+		s := math.Abs(Similarity(unit, weights))
+		if i == 0 || s > similarity {
+			index, similarity = i, s
+		}
 	}
+	return index, similarity
+}
 
-	return &Neuron{
-		I:             ii,
-		W:             ww,
-		CS:            cs,
-		ExprGraph:     g,
-		VM:            gg.NewTapeMachine(g, gg.BindDualValues(w)),
-		Nodes:         gg.Nodes{w},
-		VanillaSolver: gg.NewVanillaSolver(gg.WithLearnRate(0.5)),
-		Vectorizer:    vectorizer,
-	}
+// ScoreVector computes the similarity of a unit vector to the weights of the
+// most similar neuron
+func (n *Neuron) ScoreVector(unit []float32) float32 {
+	_, similarity := n.best(unit)
+	return float32(similarity)
 }
 
 // Train trains the neuron
@@ -74,24 +103,44 @@ func (n *Neuron) Train(input []byte) (surprise, uncertainty float32) {
 		panic(err)
 	}
 	vector := n.Vectorizer.Vectorize(object)
-	unit := Normalize(vector)
+	return n.TrainVector(Normalize(vector)), 0
+}
 
-	for i, v := range unit {
-		n.I.SetAt(v, i)
+// TrainVector computes the surprise of a unit vector and trains the most
+// similar neuron on it. Until all of the neurons are seeded the vector seeds
+// the next neuron instead
+func (n *Neuron) TrainVector(unit []float32) float32 {
+	index, similarity := n.best(unit)
+	if n.active < len(n.Weights) {
+		copy(n.Weights[n.active], unit)
+		n.active++
+		return float32(similarity)
 	}
+	n.learn(n.Weights[index], unit)
+	return float32(similarity)
+}
 
-	err = n.RunAll()
-	if err != nil {
-		panic(err)
+// learn takes a gradient descent step on the cost (1 - cs)^2, where cs is the
+// cosine similarity between the input and the weights
+func (n *Neuron) learn(weights, input []float32) {
+	dot, ii, ww := 0.0, 0.0, 0.0
+	for i, w := range weights {
+		x, y := float64(input[i]), float64(w)
+		dot += x * y
+		ii += x * x
+		ww += y * y
 	}
-	defer n.Reset()
-
-	cs := n.CS.Value().Data().(float32)
-
-	err = n.Step(n.Nodes)
-	if err != nil {
-		panic(err)
+	mi, mw := math.Sqrt(ii), math.Sqrt(ww)
+	// the cosine similarity is undefined for zero or NaN vectors
+	if mi == 0 || mw == 0 || math.IsNaN(mi) || math.IsNaN(mw) {
+		return
+	}
+	cs := dot / (mi * mw)
+	// d(1 - cs)^2/dw = -2(1 - cs)(x/(|x||w|) - cs w/|w|^2)
+	a, b := -2*(1-cs)/(mi*mw), 2*(1-cs)*cs/ww
+	rate := float64(n.LearnRate)
+	for i, w := range weights {
+		gradient := a*float64(input[i]) + b*float64(w)
+		weights[i] = float32(float64(w) - rate*gradient)
 	}
-
-	return float32(math.Abs(float64(cs))), 0
 }
@@ -0,0 +1,36 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestNeuronLearn checks that a neuron doesn't learn from a zero or NaN
+// vector and learns the direction of other vectors
+func TestNeuronLearn(t *testing.T) {
+	neuron := NewNeuron(rand.New(rand.NewSource(1)), NewVectorizer(4, true, NewLFSR32Source)).(*Neuron)
+	weights := append([]float32(nil), neuron.Weights[0]...)
+	nan := float32(math.NaN())
+	for _, unit := range [][]float32{{0, 0, 0, 0}, {nan, 0, 0, 0}} {
+		neuron.TrainVector(unit)
+		for i, w := range neuron.Weights[0] {
+			if w != weights[i] {
+				t.Fatalf("neuron learned from %v: weights are %v, not %v", unit, neuron.Weights[0], weights)
+			}
+		}
+	}
+
+	unit := []float32{1, 0, 0, 0}
+	before := neuron.ScoreVector(unit)
+	for i := 0; i < 10; i++ {
+		neuron.TrainVector(unit)
+	}
+	if after := neuron.ScoreVector(unit); !(after > before) {
+		t.Errorf("similarity is %v after learning, not more than %v", after, before)
+	}
+}
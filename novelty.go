@@ -0,0 +1,99 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"math"
+	"math/rand"
+)
+
+const (
+	// noveltyWidth is the width of the novelty sketch
+	noveltyWidth = 1 << 16
+	// noveltyDepth is the depth of the novelty sketch
+	noveltyDepth = 4
+	// noveltyRare is the number of documents below which a word is rare
+	noveltyRare = 3
+)
+
+// NovelWord is a path/value word that is unseen or rare
+type NovelWord struct {
+	Word  []string
+	Count uint32
+}
+
+// NoveltyResult is the result of novelty detection for a document
+type NoveltyResult struct {
+	Surprise     float32
+	Unseen, Rare int
+	Words        []NovelWord
+}
+
+// Novelty detects the first appearance of paths and values by counting the
+// documents each path/value word has been seen in
+type Novelty struct {
+	*CountMinSketch
+	Rare      uint32
+	Documents uint64
+}
+
+// NewNovelty creates a new novelty detector
+func NewNovelty(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+	return &Novelty{
+		CountMinSketch: NewCountMinSketch(noveltyWidth, noveltyDepth),
+		Rare:           noveltyRare,
+	}
+}
+
+// Detect computes the novelty of a document and then learns its words
+func (n *Novelty) Detect(input []byte) *NoveltyResult {
+	var object map[string]interface{}
+	err := json.Unmarshal(input, &object)
+	if err != nil {
+		panic(err)
+	}
+
+	result, seen := &NoveltyResult{}, make(map[uint64]bool)
+	Words(object, func(word []string) {
+		for i := range word {
+			h := hashWord(word[i:])
+			if seen[h] {
+				continue
+			}
+			seen[h] = true
+
+			count := n.Count(h)
+			if count >= n.Rare {
+				continue
+			}
+			result.Surprise += float32(math.Log2(float64(n.Documents+1) / float64(count+1)))
+			if i > 0 {
+				continue
+			}
+			if count == 0 {
+				result.Unseen++
+			} else {
+				result.Rare++
+			}
+			result.Words = append(result.Words, NovelWord{
+				Word:  append([]string(nil), word...),
+				Count: count,
+			})
+		}
+	})
+
+	for h := range seen {
+		n.Add(h)
+	}
+	n.Documents++
+
+	return result
+}
+
+// Train computes the surprise with the novelty detector
+func (n *Novelty) Train(input []byte) (surprise, uncertainty float32) {
+	return n.Detect(input).Surprise, 0
+}
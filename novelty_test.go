@@ -0,0 +1,86 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestNovelty checks the novelty of a sequence of documents
+func TestNovelty(t *testing.T) {
+	tests := []struct {
+		document     string
+		surprise     float64
+		unseen, rare int
+	}{
+		{`{"a":"x"}`, 0, 1, 0},
+		{`{"a":"x"}`, 0, 0, 1},
+		{`{"a":"x"}`, 0, 0, 1},
+		{`{"a":"x"}`, 0, 0, 0},
+		// the word and the value are unseen in 4 documents
+		{`{"a":"y"}`, 2 * math.Log2(5), 1, 0},
+		// only the word is unseen, the value is common
+		{`{"b":"x"}`, math.Log2(6), 1, 0},
+		// the word is unseen and its value is rare, seen in 1 of 6 documents
+		{`{"b":"y"}`, math.Log2(7) + math.Log2(7.0/2), 1, 0},
+		// objects nested directly under a key aren't words
+		{`{"c":{"d":"z"}}`, 0, 0, 0},
+	}
+	novelty := NewNovelty(rand.New(rand.NewSource(1)), nil).(*Novelty)
+	for i, test := range tests {
+		result := novelty.Detect([]byte(test.document))
+		if math.Abs(float64(result.Surprise)-test.surprise) > 1e-5 {
+			t.Errorf("%d %s: surprise is %v, expected %v", i, test.document, result.Surprise, test.surprise)
+		}
+		if result.Unseen != test.unseen || result.Rare != test.rare {
+			t.Errorf("%d %s: %d unseen and %d rare, expected %d and %d", i, test.document,
+				result.Unseen, result.Rare, test.unseen, test.rare)
+		}
+		if len(result.Words) != result.Unseen+result.Rare {
+			t.Errorf("%d %s: %d words, expected %d", i, test.document, len(result.Words), result.Unseen+result.Rare)
+		}
+	}
+}
+
+// TestNoveltyCollision checks that a word isn't seen because its strings
+// have the same concatenation as another word
+func TestNoveltyCollision(t *testing.T) {
+	novelty := NewNovelty(rand.New(rand.NewSource(1)), nil).(*Novelty)
+	novelty.Detect([]byte(`{"k":"ax"}`))
+	if result := novelty.Detect([]byte(`{"a":"x"}`)); result.Unseen != 1 || result.Rare != 0 {
+		t.Errorf("%d unseen and %d rare, expected 1 and 0", result.Unseen, result.Rare)
+	}
+}
+
+// TestCountMinSketch checks that the sketch counts distinct items exactly and
+// never underestimates colliding items
+func TestCountMinSketch(t *testing.T) {
+	sketch := NewCountMinSketch(1<<10, 4)
+	for i := uint64(0); i < 100; i++ {
+		for j := uint64(0); j <= i%5; j++ {
+			sketch.Add(i * 0x9E3779B97F4A7C15)
+		}
+	}
+	for i := uint64(0); i < 100; i++ {
+		if count := sketch.Count(i * 0x9E3779B97F4A7C15); count != uint32(i%5+1) {
+			t.Errorf("count of %d is %d, expected %d", i, count, i%5+1)
+		}
+	}
+	if sketch.Total != 300 {
+		t.Errorf("total is %d, expected 300", sketch.Total)
+	}
+
+	small := NewCountMinSketch(4, 2)
+	for i := uint64(0); i < 16; i++ {
+		small.Add(i)
+	}
+	for i := uint64(0); i < 16; i++ {
+		if count := small.Count(i); count < 1 {
+			t.Errorf("count of %d is %d, expected at least 1", i, count)
+		}
+	}
+}
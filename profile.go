@@ -0,0 +1,168 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"math"
+	"unicode/utf8"
+)
+
+// Profiler computes the surprise of each byte of an input without learning
+type Profiler interface {
+	Profile(input []byte) []float32
+}
+
+// TokenSurprise is the surprise of a JSON token
+type TokenSurprise struct {
+	Begin, End int
+	Surprise   float32
+}
+
+// Average computes the average surprise of the bytes of the token
+func (t TokenSurprise) Average() float32 {
+	return t.Surprise / float32(t.End-t.Begin)
+}
+
+// Tokenize splits JSON into tokens, returning the begin and end offsets of
+// each token. Whitespace isn't part of any token
+func Tokenize(input []byte) (begins, ends []int) {
+	isDelimiter := func(s byte) bool {
+		switch s {
+		case '{', '}', '[', ']', ':', ',', '"', ' ', '\t', '\n', '\r':
+			return true
+		}
+		return false
+	}
+	for i := 0; i < len(input); {
+		begin := i
+		switch input[i] {
+		case ' ', '\t', '\n', '\r':
+			i++
+			continue
+		case '{', '}', '[', ']', ':', ',':
+			i++
+		case '"':
+			for i++; i < len(input) && input[i] != '"'; i++ {
+				if input[i] == '\\' {
+					i++
+				}
+			}
+			if i < len(input) {
+				i++
+			} else {
+				// a truncated string can end with an escape
+				i = len(input)
+			}
+		default:
+			for i++; i < len(input) && !isDelimiter(input[i]); i++ {
+			}
+		}
+		begins, ends = append(begins, begin), append(ends, i)
+	}
+	return
+}
+
+// TokenProfile aggregates the surprise of each byte into the surprise of
+// each JSON token
+func TokenProfile(input []byte, profile []float32) []TokenSurprise {
+	begins, ends := Tokenize(input)
+	tokens := make([]TokenSurprise, len(begins))
+	for i, begin := range begins {
+		tokens[i].Begin, tokens[i].End = begin, ends[i]
+		for _, cost := range profile[begin:ends[i]] {
+			tokens[i].Surprise += cost
+		}
+	}
+	return tokens
+}
+
+// surpriseLevels assigns a level of 0, 1 or 2 to each byte of a profile
+// depending on how many standard deviations it is above the average
+func surpriseLevels(profile []float32) []int {
+	sum, sumSquared, length := 0.0, 0.0, float64(len(profile))
+	for _, v := range profile {
+		value := float64(v)
+		sum += value
+		sumSquared += value * value
+	}
+	average := sum / length
+	stddev := math.Sqrt(sumSquared/length - average*average)
+
+	levels := make([]int, len(profile))
+	if stddev == 0 {
+		return levels
+	}
+	for i, v := range profile {
+		z := (float64(v) - average) / stddev
+		if z >= 2 {
+			levels[i] = 2
+		} else if z >= 1 {
+			levels[i] = 1
+		}
+	}
+	return levels
+}
+
+// highlight renders the spans of the input with the same surprise level, the
+// bytes of a rune share the highest level of the rune
+func highlight(input []byte, profile []float32, span func(b *bytes.Buffer, text []byte, level int)) string {
+	var b bytes.Buffer
+	levels := surpriseLevels(profile)
+	for i := 0; i < len(input); {
+		_, size := utf8.DecodeRune(input[i:])
+		level := 0
+		for _, l := range levels[i : i+size] {
+			if l > level {
+				level = l
+			}
+		}
+		for j := range levels[i : i+size] {
+			levels[i+j] = level
+		}
+		i += size
+	}
+	for i := 0; i < len(input); {
+		j := i + 1
+		for j < len(input) && levels[j] == levels[i] {
+			j++
+		}
+		span(&b, input[i:j], levels[i])
+		i = j
+	}
+	return b.String()
+}
+
+// HighlightANSI renders the input for a terminal with the most surprising
+// spans highlighted
+func HighlightANSI(input []byte, profile []float32) string {
+	colors := [...]string{"", "\x1b[33m", "\x1b[1;31m"}
+	return highlight(input, profile, func(b *bytes.Buffer, text []byte, level int) {
+		if level == 0 {
+			b.Write(text)
+			return
+		}
+		b.WriteString(colors[level])
+		b.Write(text)
+		b.WriteString("\x1b[0m")
+	})
+}
+
+// HighlightHTML renders the input as HTML with the most surprising spans
+// highlighted
+func HighlightHTML(input []byte, profile []float32) string {
+	colors := [...]string{"", "#ffe680", "#ff8080"}
+	return "<pre>" + highlight(input, profile, func(b *bytes.Buffer, text []byte, level int) {
+		escaped := html.EscapeString(string(text))
+		if level == 0 {
+			b.WriteString(escaped)
+			return
+		}
+		fmt.Fprintf(b, `<span class="surprise%d" style="background-color:%s">%s</span>`,
+			level, colors[level], escaped)
+	}) + "</pre>"
+}
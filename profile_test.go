@@ -0,0 +1,95 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"reflect"
+	"testing"
+)
+
+// TestTokenize checks the tokens of complete and truncated JSON
+func TestTokenize(t *testing.T) {
+	tests := []struct {
+		input  string
+		tokens []string
+	}{
+		{``, nil},
+		{` `, nil},
+		{`{"a": 1}`, []string{`{`, `"a"`, `:`, `1`, `}`}},
+		{`["a\"b", true,null]`, []string{`[`, `"a\"b"`, `,`, `true`, `,`, `null`, `]`}},
+		{`{"a":"b`, []string{`{`, `"a"`, `:`, `"b`}},
+		{`{"a":"b\`, []string{`{`, `"a"`, `:`, `"b\`}},
+		{`"\`, []string{`"\`}},
+		{`12.5e3`, []string{`12.5e3`}},
+	}
+	for _, test := range tests {
+		begins, ends := Tokenize([]byte(test.input))
+		var tokens []string
+		for i, begin := range begins {
+			tokens = append(tokens, test.input[begin:ends[i]])
+		}
+		if !reflect.DeepEqual(tokens, test.tokens) {
+			t.Errorf("%q: tokens are %q, expected %q", test.input, tokens, test.tokens)
+		}
+	}
+}
+
+// TestTokenProfile checks the surprise of each token
+func TestTokenProfile(t *testing.T) {
+	tests := []struct {
+		input   string
+		profile []float32
+		tokens  []TokenSurprise
+	}{
+		{``, nil, []TokenSurprise{}},
+		{`{"a":1}`, []float32{0, 1, 2, 3, 4, 5, 6}, []TokenSurprise{
+			{0, 1, 0}, {1, 4, 6}, {4, 5, 4}, {5, 6, 5}, {6, 7, 6},
+		}},
+		{`["\`, []float32{0, 1, 2}, []TokenSurprise{{0, 1, 0}, {1, 3, 3}}},
+	}
+	for _, test := range tests {
+		tokens := TokenProfile([]byte(test.input), test.profile)
+		if !reflect.DeepEqual(tokens, test.tokens) {
+			t.Errorf("%q: tokens are %v, expected %v", test.input, tokens, test.tokens)
+		}
+	}
+	if average := (TokenSurprise{1, 4, 6}).Average(); average != 2 {
+		t.Errorf("average is %v, expected 2", average)
+	}
+}
+
+// TestHighlight checks that the most surprising spans are highlighted
+func TestHighlight(t *testing.T) {
+	tests := []struct {
+		input   string
+		profile []float32
+		ansi    string
+		html    string
+	}{
+		{``, nil, ``, `<pre></pre>`},
+		{`abc`, []float32{1, 1, 1}, `abc`, `<pre>abc</pre>`},
+		{
+			`<abcdefgh>`,
+			[]float32{9, 0, 0, 0, 0, 0, 0, 0, 0, 0},
+			"\x1b[1;31m<\x1b[0mabcdefgh>",
+			`<pre><span class="surprise2" style="background-color:#ff8080">&lt;</span>abcdefgh&gt;</pre>`,
+		},
+		{
+			// the bytes of a rune share a level
+			"aé",
+			[]float32{0, 0, 1},
+			"a\x1b[33mé\x1b[0m",
+			`<pre>a<span class="surprise1" style="background-color:#ffe680">é</span></pre>`,
+		},
+	}
+	for _, test := range tests {
+		if ansi := HighlightANSI([]byte(test.input), test.profile); ansi != test.ansi {
+			t.Errorf("%q: ANSI is %q, expected %q", test.input, ansi, test.ansi)
+		}
+		if html := HighlightHTML([]byte(test.input), test.profile); html != test.html {
+			t.Errorf("%q: HTML is %q, expected %q", test.input, html, test.html)
+		}
+	}
+}
@@ -0,0 +1,332 @@
+package rnn
+
+import (
+	"fmt"
+	"math"
+	"math/rand"
+	"strconv"
+
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// Bidirectional is an anomaly detection engine that predicts each symbol from
+// the symbols on both sides of it. A forward and a backward recurrent network
+// read the document from each end and their hidden states are combined before
+// the decoder. Documents are read in windows of Steps symbols, both for
+// learning and for scoring, so a symbol is predicted from at most Steps-1
+// other symbols. DefaultBidirectionalOptions has longer windows than
+// DefaultOptions
+// https://github.com/vmarkovtsev/BiDiSentiment
+type Bidirectional struct {
+	forward, backward *Model
+	// decoder of the combined hidden states
+	whd, biasD *tensor.Dense
+
+	learner   *biGraph
+	optimizer *Optimizer
+	tokenizer Tokenizer
+	steps     int
+}
+
+// biGraph learns from windows of symbols
+type biGraph struct {
+	g               *G.ExprGraph
+	learnables      G.Nodes
+	inputs, outputs []*tensor.Dense
+	masks           []map[int]*tensor.Dense
+	cost            *G.Node
+	machine         G.VM
+}
+
+// NewBidirectional creates a new bidirectional anomaly detection engine with
+// layers of the given cell and the given hyperparameters. Steps is the size of
+// the windows, it panics if the options aren't valid
+func NewBidirectional(rnd *rand.Rand, cell Cell, options Options) *Bidirectional {
+	if err := options.Validate(); err != nil {
+		panic(err)
+	}
+	tokenizer := options.Tokenizer
+	if tokenizer == nil {
+		tokenizer = ByteTokenizer{}
+	}
+	size := tokenizer.Size()
+	embedding := tensor.New(tensor.WithShape(options.EmbeddingSize, size),
+		tensor.WithBacking(gaussian32(rnd, options.EmbeddingSize, size)))
+	direction := func() *Model {
+		m := &Model{
+			cell:          cell,
+			embedding:     embedding,
+			inputSize:     size,
+			embeddingSize: options.EmbeddingSize,
+			hiddenSizes:   options.HiddenSizes,
+		}
+		previous := options.EmbeddingSize
+		for _, hiddenSize := range options.HiddenSizes {
+			m.layers = append(m.layers, cell.Weights(rnd, previous, hiddenSize))
+			previous = hiddenSize
+		}
+		return m
+	}
+	forward, backward := direction(), direction()
+	previous := options.HiddenSizes[len(options.HiddenSizes)-1]
+	combined := 2 * previous
+
+	b := &Bidirectional{
+		forward:  forward,
+		backward: backward,
+		whd: tensor.New(tensor.WithShape(size, combined),
+			tensor.WithBacking(gaussian32(rnd, size, combined))),
+		biasD:     tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(size)),
+		optimizer: options.NewOptimizer(),
+		tokenizer: tokenizer,
+		steps:     options.Steps,
+	}
+	b.learner = b.newGraph(options.Steps)
+	return b
+}
+
+// newGraph builds the graph for learning from windows of symbols. Symbols
+// past the end of a window are masked so they don't change the states of the
+// backward network
+func (b *Bidirectional) newGraph(steps int) *biGraph {
+	bg := &biGraph{
+		g:       G.NewGraph(),
+		inputs:  make([]*tensor.Dense, steps),
+		outputs: make([]*tensor.Dense, steps),
+		masks:   make([]map[int]*tensor.Dense, steps),
+	}
+	g, size := bg.g, b.forward.embedding.Shape()[1]
+	embedding := G.NodeFromAny(g, b.forward.embedding, G.WithName("embedding"))
+	whd := G.NodeFromAny(g, b.whd, G.WithName("whd"))
+	biasD := G.NodeFromAny(g, b.biasD, G.WithName("bias_d"))
+	bg.learnables = G.Nodes{embedding}
+	direction := func(m *Model, prefix string) ([]G.Nodes, []G.Nodes) {
+		layers, initial := make([]G.Nodes, len(m.layers)), make([]G.Nodes, len(m.layers))
+		for depth, weights := range m.layers {
+			layerID := strconv.Itoa(depth)
+			layers[depth] = make(G.Nodes, len(weights))
+			for i, weight := range weights {
+				layers[depth][i] = G.NodeFromAny(g, weight.Value, G.WithName(prefix+weight.Name+"_"+layerID))
+			}
+			bg.learnables = append(bg.learnables, layers[depth]...)
+			initial[depth] = make(G.Nodes, m.cell.States())
+			for i := range initial[depth] {
+				initial[depth][i] = G.NewVector(g, G.Float32, G.WithShape(m.hiddenSizes[depth]),
+					G.WithName(fmt.Sprintf("%sstate%d_%s", prefix, i, layerID)), G.WithInit(G.Zeroes()))
+			}
+		}
+		return layers, initial
+	}
+	forwardLayers, forwardInitial := direction(b.forward, "fw_")
+	backwardLayers, backwardInitial := direction(b.backward, "bw_")
+	bg.learnables = append(bg.learnables, whd, biasD)
+
+	step := func(m *Model, layers []G.Nodes, input *G.Node, previous []G.Nodes) []G.Nodes {
+		states := make([]G.Nodes, len(layers))
+		for i, weights := range layers {
+			states[i] = m.cell.Forward(weights, input, previous[i])
+			input = states[i][0]
+		}
+		return states
+	}
+
+	embedded, masks := make(G.Nodes, steps), make([]map[int]*G.Node, steps)
+	for t := 0; t < steps; t++ {
+		id := strconv.Itoa(t)
+		bg.inputs[t] = tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(size))
+		input := G.NewVector(g, tensor.Float32, G.WithName("input_"+id),
+			G.WithShape(size), G.WithValue(bg.inputs[t]))
+		embedded[t] = G.Must(G.Mul(embedding, input))
+		bg.masks[t], masks[t] = make(map[int]*tensor.Dense), make(map[int]*G.Node)
+		for _, hiddenSize := range b.backward.hiddenSizes {
+			if _, ok := masks[t][hiddenSize]; ok {
+				continue
+			}
+			bg.masks[t][hiddenSize] = tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(hiddenSize))
+			masks[t][hiddenSize] = G.NewVector(g, tensor.Float32,
+				G.WithName("mask_"+id+"_"+strconv.Itoa(hiddenSize)),
+				G.WithShape(hiddenSize), G.WithValue(bg.masks[t][hiddenSize]))
+		}
+	}
+
+	// forward[t] are the states after the symbols before t
+	forward := make([][]G.Nodes, steps)
+	forward[0] = forwardInitial
+	for t := 1; t < steps; t++ {
+		forward[t] = step(b.forward, forwardLayers, embedded[t-1], forward[t-1])
+	}
+
+	// backward[t] are the states after the symbols after t, read from the end
+	one := G.NewConstant(float32(1))
+	backward := make([][]G.Nodes, steps)
+	backward[steps-1] = backwardInitial
+	for t := steps - 2; t >= 0; t-- {
+		next := step(b.backward, backwardLayers, embedded[t+1], backward[t+1])
+		for i, states := range next {
+			mask := masks[t+1][b.backward.hiddenSizes[i]]
+			keep := G.Must(G.Sub(one, mask))
+			for j, state := range states {
+				write := G.Must(G.HadamardProd(state, mask))
+				retain := G.Must(G.HadamardProd(backward[t+1][i][j], keep))
+				next[i][j] = G.Must(G.Add(write, retain))
+			}
+		}
+		backward[t] = next
+	}
+
+	for t := 0; t < steps; t++ {
+		fw, bw := forward[t][len(forward[t])-1][0], backward[t][len(backward[t])-1][0]
+		hidden := G.Must(G.Concat(0, fw, bw))
+		probs := G.Must(G.SoftMax(G.Must(G.Add(G.Must(G.Mul(whd, hidden)), biasD))))
+		logprob := G.Must(G.Neg(G.Must(G.Log(probs))))
+		bg.outputs[t] = tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(size))
+		output := G.NewVector(g, tensor.Float32, G.WithName("output_"+strconv.Itoa(t)),
+			G.WithShape(size), G.WithValue(bg.outputs[t]))
+		loss := G.Must(G.Mul(logprob, output))
+		if bg.cost == nil {
+			bg.cost = loss
+		} else {
+			bg.cost = G.Must(G.Add(bg.cost, loss))
+		}
+	}
+
+	_, err := G.Grad(bg.cost, bg.learnables...)
+	if err != nil {
+		panic(err)
+	}
+	bg.machine = G.NewTapeMachine(g, G.BindDualValues(bg.learnables...))
+	return bg
+}
+
+// learn learns from the symbols in windows, the cost of each window is
+// computed before learning from it
+func (b *Bidirectional) learn(symbols []int) (cost float32, err error) {
+	bg := b.learner
+	steps := len(bg.inputs)
+	for x := 0; x < len(symbols); x += steps {
+		for t := 0; t < steps; t++ {
+			bg.inputs[t].Zero()
+			bg.outputs[t].Zero()
+			mask := float32(0)
+			if x+t < len(symbols) {
+				bg.inputs[t].SetF32(symbols[x+t], 1.0)
+				bg.outputs[t].SetF32(symbols[x+t], 1.0)
+				mask = 1
+			}
+			for _, m := range bg.masks[t] {
+				m.Memset(mask)
+			}
+		}
+
+		if err = bg.machine.RunAll(); err != nil {
+			return
+		}
+		if err = b.optimizer.Update(bg.learnables); err != nil {
+			return
+		}
+		if cv, ok := bg.cost.Value().(G.Scalar); ok {
+			cost += cv.Data().(float32)
+		}
+		bg.machine.Reset()
+	}
+	return
+}
+
+// hidden computes the hidden states of the last layer of a direction without
+// a graph, hidden[t] is the hidden state after the symbols before t
+func hidden(m *Model, symbols []int) [][]float32 {
+	states := make([][]float32, len(symbols))
+	s := m.newState()
+	last := s.states[len(s.states)-1][0]
+	for t, symbol := range symbols {
+		states[t] = append([]float32(nil), last...)
+		s.step(symbol)
+	}
+	return states
+}
+
+// costs computes the cost of predicting each symbol from the symbols on both
+// sides of it in its window without a graph
+func (b *Bidirectional) costs(symbols []int) []float32 {
+	costs := make([]float32, 0, len(symbols))
+	for x := 0; x < len(symbols); x += b.steps {
+		end := x + b.steps
+		if end > len(symbols) {
+			end = len(symbols)
+		}
+		costs = append(costs, b.window(symbols[x:end])...)
+	}
+	return costs
+}
+
+// window computes the cost of predicting each symbol of a window from the
+// symbols on both sides of it
+func (b *Bidirectional) window(symbols []int) []float32 {
+	n := len(symbols)
+	reversed := make([]int, n)
+	for i, symbol := range symbols {
+		reversed[n-1-i] = symbol
+	}
+	forward, backward := hidden(b.forward, symbols), hidden(b.backward, reversed)
+
+	logits, costs := make([]float32, len(b.biasD.Data().([]float32))), make([]float32, n)
+	for t, symbol := range symbols {
+		copy(logits, b.biasD.Data().([]float32))
+		mulVec(b.whd, append(forward[t], backward[n-1-t]...), logits)
+		max := logits[0]
+		for _, v := range logits {
+			if v > max {
+				max = v
+			}
+		}
+		sum := 0.0
+		for _, v := range logits {
+			sum += math.Exp(float64(v - max))
+		}
+		costs[t] = float32(math.Log(sum)) - (logits[symbol] - max)
+	}
+	return costs
+}
+
+// Costs computes the cost of predicting each symbol of the input from the
+// symbols on both sides of it
+func (b *Bidirectional) Costs(input []byte) []float32 {
+	symbols, _ := b.tokenizer.Encode(input)
+	return b.costs(symbols)
+}
+
+// Profile computes the surprise of each byte of the input, the surprise of a
+// symbol is spread over its bytes
+func (b *Bidirectional) Profile(input []byte) []float32 {
+	profile := make([]float32, len(input))
+	symbols, ends := b.tokenizer.Encode(input)
+	begin := 0
+	for i, cost := range b.costs(symbols) {
+		end := ends[i]
+		for j := begin; j < end; j++ {
+			profile[j] = cost / float32(end-begin)
+		}
+		begin = end
+	}
+	return profile
+}
+
+// Score computes the surprise without learning
+func (b *Bidirectional) Score(input []byte) (surprise, uncertainty float32) {
+	for _, cost := range b.Costs(input) {
+		surprise += cost
+	}
+	return surprise / float32(len(input)), 0
+}
+
+// Train computes the surprise of the input and learns from it
+func (b *Bidirectional) Train(input []byte) (surprise, uncertainty float32) {
+	surprise, _ = b.Score(input)
+	symbols, _ := b.tokenizer.Encode(input)
+	_, err := b.learn(symbols)
+	if err != nil {
+		panic(fmt.Sprintf("%+v", err))
+	}
+	return surprise, 0
+}
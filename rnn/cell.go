@@ -0,0 +1,236 @@
+package rnn
+
+import (
+	"math"
+	"math/rand"
+
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// Weight is a named weight of a layer of cells
+type Weight struct {
+	Name  string
+	Value *tensor.Dense
+}
+
+// Cell is a type of recurrent cell
+type Cell interface {
+	// States is the number of state vectors of a layer of cells, the first
+	// state is the hidden state which is the output of the layer
+	States() int
+	// Weights creates the weights of a layer of cells
+	Weights(rnd *rand.Rand, inputSize, hiddenSize int) []Weight
+	// Forward computes the next states of a layer of cells given the nodes of
+	// its weights, its input and its previous states
+	Forward(weights G.Nodes, input *G.Node, states G.Nodes) G.Nodes
+	// Step computes the next states of a layer of cells in place without a
+	// graph, it is the same computation as Forward
+	Step(weights []Weight, input []float32, states [][]float32)
+}
+
+// embeddingLast is implemented by cells with models that create the embedding
+// after the other weights
+type embeddingLast interface {
+	EmbeddingLast() bool
+}
+
+// gaussian32 creates normally distributed weights for a matrix
+func gaussian32(rnd *rand.Rand, s ...int) []float32 {
+	size := tensor.Shape(s).TotalSize()
+	weights, stdev := make([]float32, size), math.Sqrt(2/float64(s[len(s)-1]))
+	for i := range weights {
+		weights[i] = float32(rnd.NormFloat64() * stdev)
+	}
+	return weights
+}
+
+// matrix creates a normally distributed weight matrix
+func matrix(rnd *rand.Rand, name string, rows, cols int) Weight {
+	return Weight{
+		Name:  name,
+		Value: tensor.New(tensor.WithShape(rows, cols), tensor.WithBacking(gaussian32(rnd, rows, cols))),
+	}
+}
+
+// bias creates a zero bias vector
+func bias(name string, size int) Weight {
+	return Weight{
+		Name:  name,
+		Value: tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(size)),
+	}
+}
+
+// gate computes activation(w*input + u*hidden + b)
+func gate(activation func(*G.Node) (*G.Node, error), w, u, b, input, hidden *G.Node) *G.Node {
+	x := G.Must(G.Mul(w, input))
+	y := G.Must(G.Mul(u, hidden))
+	return G.Must(activation(G.Must(G.Add(G.Must(G.Add(x, y)), b))))
+}
+
+// LSTM is a long short-term memory cell
+// https://en.wikipedia.org/wiki/Long_short-term_memory
+type LSTM struct{}
+
+// States is the hidden state and the cell state
+func (LSTM) States() int {
+	return 2
+}
+
+// Weights creates the weights of the input, forget and output gates and of
+// the cell write
+func (LSTM) Weights(rnd *rand.Rand, inputSize, hiddenSize int) []Weight {
+	wix := matrix(rnd, "wix", hiddenSize, inputSize)
+	wih := matrix(rnd, "wih", hiddenSize, hiddenSize)
+	wox := matrix(rnd, "wox", hiddenSize, inputSize)
+	woh := matrix(rnd, "woh", hiddenSize, hiddenSize)
+	wfx := matrix(rnd, "wfx", hiddenSize, inputSize)
+	wfh := matrix(rnd, "wfh", hiddenSize, hiddenSize)
+	wcx := matrix(rnd, "wcx", hiddenSize, inputSize)
+	wch := matrix(rnd, "wch", hiddenSize, hiddenSize)
+	return []Weight{
+		wix, wih, bias("bias_i", hiddenSize),
+		wfx, wfh, bias("bias_f", hiddenSize),
+		wox, woh, bias("bias_o", hiddenSize),
+		wcx, wch, bias("bias_c", hiddenSize),
+	}
+}
+
+// EmbeddingLast keeps the weight initialization order of the original LSTM
+// model
+func (LSTM) EmbeddingLast() bool {
+	return true
+}
+
+// Forward computes the next hidden and cell states
+func (LSTM) Forward(w G.Nodes, input *G.Node, states G.Nodes) G.Nodes {
+	prevHidden, prevCell := states[0], states[1]
+	inputGate := gate(G.Sigmoid, w[0], w[1], w[2], input, prevHidden)
+	forgetGate := gate(G.Sigmoid, w[3], w[4], w[5], input, prevHidden)
+	outputGate := gate(G.Sigmoid, w[6], w[7], w[8], input, prevHidden)
+	cellWrite := gate(G.Tanh, w[9], w[10], w[11], input, prevHidden)
+
+	retain := G.Must(G.HadamardProd(forgetGate, prevCell))
+	write := G.Must(G.HadamardProd(inputGate, cellWrite))
+	cell := G.Must(G.Add(retain, write))
+	hidden := G.Must(G.HadamardProd(outputGate, G.Must(G.Tanh(cell))))
+	return G.Nodes{hidden, cell}
+}
+
+// GRU is a gated recurrent unit with a single gate used for both reset and
+// update
+// https://en.wikipedia.org/wiki/Gated_recurrent_unit
+type GRU struct{}
+
+// States is the hidden state
+func (GRU) States() int {
+	return 1
+}
+
+// Weights creates the weights of the gate and of the candidate state
+func (GRU) Weights(rnd *rand.Rand, inputSize, hiddenSize int) []Weight {
+	wf := matrix(rnd, "wf", hiddenSize, inputSize)
+	uf := matrix(rnd, "uf", hiddenSize, hiddenSize)
+	br := bias("br", hiddenSize)
+	wh := matrix(rnd, "wh", hiddenSize, inputSize)
+	uh := matrix(rnd, "uh", hiddenSize, hiddenSize)
+	bh := bias("bh", hiddenSize)
+	return []Weight{wf, uf, br, wh, uh, bh}
+}
+
+// Forward computes the next hidden state
+func (GRU) Forward(w G.Nodes, input *G.Node, states G.Nodes) G.Nodes {
+	previous := states[0]
+	f := gate(G.Sigmoid, w[0], w[1], w[2], input, previous)
+	z := gate(G.Tanh, w[3], w[4], w[5], input, G.Must(G.HadamardProd(f, previous)))
+
+	one := G.NewConstant(float32(1))
+	a := G.Must(G.HadamardProd(G.Must(G.Sub(one, f)), z))
+	b := G.Must(G.HadamardProd(f, previous))
+	return G.Nodes{G.Must(G.Add(a, b))}
+}
+
+// Elman is a vanilla recurrent cell
+// https://en.wikipedia.org/wiki/Recurrent_neural_network#Elman_networks_and_Jordan_networks
+type Elman struct{}
+
+// States is the hidden state
+func (Elman) States() int {
+	return 1
+}
+
+// Weights creates the input and recurrent weights
+func (Elman) Weights(rnd *rand.Rand, inputSize, hiddenSize int) []Weight {
+	w := matrix(rnd, "w", hiddenSize, inputSize)
+	u := matrix(rnd, "u", hiddenSize, hiddenSize)
+	return []Weight{w, u, bias("b", hiddenSize)}
+}
+
+// Forward computes the next hidden state
+func (Elman) Forward(w G.Nodes, input *G.Node, states G.Nodes) G.Nodes {
+	return G.Nodes{gate(G.Tanh, w[0], w[1], w[2], input, states[0])}
+}
+
+// MGU is a minimal gated unit
+// https://arxiv.org/abs/1603.09420
+type MGU struct{}
+
+// States is the hidden state
+func (MGU) States() int {
+	return 1
+}
+
+// Weights creates the weights of the forget gate and of the candidate state
+func (MGU) Weights(rnd *rand.Rand, inputSize, hiddenSize int) []Weight {
+	wf := matrix(rnd, "wf", hiddenSize, inputSize)
+	uf := matrix(rnd, "uf", hiddenSize, hiddenSize)
+	bf := bias("bf", hiddenSize)
+	wh := matrix(rnd, "wh", hiddenSize, inputSize)
+	uh := matrix(rnd, "uh", hiddenSize, hiddenSize)
+	bh := bias("bh", hiddenSize)
+	return []Weight{wf, uf, bf, wh, uh, bh}
+}
+
+// Forward computes the next hidden state
+func (MGU) Forward(w G.Nodes, input *G.Node, states G.Nodes) G.Nodes {
+	previous := states[0]
+	f := gate(G.Sigmoid, w[0], w[1], w[2], input, previous)
+	candidate := gate(G.Tanh, w[3], w[4], w[5], input, G.Must(G.HadamardProd(f, previous)))
+
+	one := G.NewConstant(float32(1))
+	retain := G.Must(G.HadamardProd(G.Must(G.Sub(one, f)), previous))
+	write := G.Must(G.HadamardProd(f, candidate))
+	return G.Nodes{G.Must(G.Add(retain, write))}
+}
+
+// IndRNN is an independently recurrent cell where each neuron only receives
+// its own previous state
+// https://arxiv.org/abs/1803.04831
+type IndRNN struct{}
+
+// States is the hidden state
+func (IndRNN) States() int {
+	return 1
+}
+
+// Weights creates the input weights and the recurrent weight vector, the
+// recurrent weights are uniformly distributed in [0, 1)
+func (IndRNN) Weights(rnd *rand.Rand, inputSize, hiddenSize int) []Weight {
+	w := matrix(rnd, "w", hiddenSize, inputSize)
+	recurrent := make([]float32, hiddenSize)
+	for i := range recurrent {
+		recurrent[i] = rnd.Float32()
+	}
+	u := Weight{
+		Name:  "u",
+		Value: tensor.New(tensor.WithShape(hiddenSize), tensor.WithBacking(recurrent)),
+	}
+	return []Weight{w, u, bias("b", hiddenSize)}
+}
+
+// Forward computes the next hidden state
+func (IndRNN) Forward(w G.Nodes, input *G.Node, states G.Nodes) G.Nodes {
+	x := G.Must(G.Mul(w[0], input))
+	y := G.Must(G.HadamardProd(w[1], states[0]))
+	return G.Nodes{G.Must(G.Rectify(G.Must(G.Add(G.Must(G.Add(x, y)), w[2]))))}
+}
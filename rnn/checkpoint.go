@@ -0,0 +1,340 @@
+package rnn
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// cells are the cells of models that can be saved
+var cells = map[string]Cell{
+	"lstm":   LSTM{},
+	"gru":    GRU{},
+	"elman":  Elman{},
+	"mgu":    MGU{},
+	"indrnn": IndRNN{},
+}
+
+// weightJSON is the JSON form of a weight
+type weightJSON struct {
+	Name  string    `json:"name,omitempty"`
+	Shape []int     `json:"shape"`
+	Data  []float32 `json:"data"`
+}
+
+// newWeightJSON converts a tensor into its JSON form
+func newWeightJSON(name string, value *tensor.Dense) weightJSON {
+	return weightJSON{
+		Name:  name,
+		Shape: append([]int(nil), value.Shape()...),
+		Data:  value.Data().([]float32),
+	}
+}
+
+// dense converts the JSON form of a weight into a tensor
+func (w weightJSON) dense() (*tensor.Dense, error) {
+	if tensor.Shape(w.Shape).TotalSize() != len(w.Data) {
+		return nil, fmt.Errorf("weight %q has shape %v and %d values", w.Name, w.Shape, len(w.Data))
+	}
+	return tensor.New(tensor.WithShape(w.Shape...), tensor.WithBacking(w.Data)), nil
+}
+
+// modelJSON is the JSON form of a model
+type modelJSON struct {
+	Cell          string         `json:"cell"`
+	InputSize     int            `json:"input_size"`
+	EmbeddingSize int            `json:"embedding_size"`
+	OutputSize    int            `json:"output_size"`
+	HiddenSizes   []int          `json:"hidden_sizes"`
+	Embedding     weightJSON     `json:"embedding"`
+	Layers        [][]weightJSON `json:"layers"`
+	Decoder       weightJSON     `json:"decoder"`
+	DecoderBias   weightJSON     `json:"decoder_bias"`
+}
+
+// MarshalJSON encodes the model and its weights as JSON
+func (m *Model) MarshalJSON() ([]byte, error) {
+	model, err := m.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(model)
+}
+
+// snapshot returns the JSON form of the model
+func (m *Model) snapshot() (modelJSON, error) {
+	name := ""
+	for key, cell := range cells {
+		if cell == m.cell {
+			name = key
+		}
+	}
+	if name == "" {
+		return modelJSON{}, fmt.Errorf("cell %T can't be saved", m.cell)
+	}
+
+	model := modelJSON{
+		Cell:          name,
+		InputSize:     m.inputSize,
+		EmbeddingSize: m.embeddingSize,
+		OutputSize:    m.outputSize,
+		HiddenSizes:   m.hiddenSizes,
+		Embedding:     newWeightJSON("embedding", m.embedding),
+		Decoder:       newWeightJSON("whd", m.whd),
+		DecoderBias:   newWeightJSON("bias_d", m.biasD),
+	}
+	for _, weights := range m.layers {
+		layer := make([]weightJSON, len(weights))
+		for i, weight := range weights {
+			layer[i] = newWeightJSON(weight.Name, weight.Value)
+		}
+		model.Layers = append(model.Layers, layer)
+	}
+	return model, nil
+}
+
+// UnmarshalJSON decodes a model and its weights from JSON
+func (m *Model) UnmarshalJSON(data []byte) error {
+	var model modelJSON
+	err := json.Unmarshal(data, &model)
+	if err != nil {
+		return err
+	}
+
+	cell, ok := cells[model.Cell]
+	if !ok {
+		return fmt.Errorf("unknown cell %q", model.Cell)
+	}
+	if len(model.Layers) != len(model.HiddenSizes) {
+		return fmt.Errorf("%d layers and %d hidden sizes", len(model.Layers), len(model.HiddenSizes))
+	}
+
+	decoded := Model{
+		cell:          cell,
+		inputSize:     model.InputSize,
+		embeddingSize: model.EmbeddingSize,
+		outputSize:    model.OutputSize,
+		hiddenSizes:   model.HiddenSizes,
+	}
+	if decoded.embedding, err = model.Embedding.dense(); err != nil {
+		return err
+	}
+	if decoded.whd, err = model.Decoder.dense(); err != nil {
+		return err
+	}
+	if decoded.biasD, err = model.DecoderBias.dense(); err != nil {
+		return err
+	}
+	for _, layer := range model.Layers {
+		weights := make([]Weight, len(layer))
+		for i, weight := range layer {
+			weights[i].Name = weight.Name
+			if weights[i].Value, err = weight.dense(); err != nil {
+				return err
+			}
+		}
+		decoded.layers = append(decoded.layers, weights)
+	}
+	*m = decoded
+	return nil
+}
+
+// assign copies the weights of a model into the weights of m, the models must
+// have the same cell and shapes. The tensors of m are kept so graphs built on
+// them see the copied weights
+func (m *Model) assign(other *Model) error {
+	if m.cell != other.cell {
+		return fmt.Errorf("model has cell %T, not %T", other.cell, m.cell)
+	}
+	if len(m.layers) != len(other.layers) {
+		return fmt.Errorf("model has %d layers, not %d", len(other.layers), len(m.layers))
+	}
+	load := func(name string, to, from *tensor.Dense) error {
+		if !to.Shape().Eq(from.Shape()) {
+			return fmt.Errorf("weight %q has shape %v, not %v", name, from.Shape(), to.Shape())
+		}
+		copy(to.Data().([]float32), from.Data().([]float32))
+		return nil
+	}
+	err := load("embedding", m.embedding, other.embedding)
+	if err != nil {
+		return err
+	}
+	if err = load("whd", m.whd, other.whd); err != nil {
+		return err
+	}
+	if err = load("bias_d", m.biasD, other.biasD); err != nil {
+		return err
+	}
+	for i, weights := range m.layers {
+		if len(weights) != len(other.layers[i]) {
+			return fmt.Errorf("layer %d has %d weights, not %d", i, len(other.layers[i]), len(weights))
+		}
+		for j, weight := range weights {
+			if err = load(weight.Name, weight.Value, other.layers[i][j].Value); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// engineJSON is the JSON form of an engine, the model with the optimizer
+type engineJSON struct {
+	modelJSON
+	Optimizer *Optimizer `json:"optimizer,omitempty"`
+}
+
+// MarshalJSON encodes the model and the optimizer of the engine as JSON, the
+// tokenizer and the hyperparameters aren't part of it
+func (e *Engine) MarshalJSON() ([]byte, error) {
+	model, err := e.Model.snapshot()
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(engineJSON{modelJSON: model, Optimizer: e.optimizer})
+}
+
+// UnmarshalJSON decodes a model and an optimizer from JSON into the engine,
+// the model must have the cell and sizes of the engine. Without an optimizer
+// the running averages of the engine start over
+func (e *Engine) UnmarshalJSON(data []byte) error {
+	var model Model
+	err := json.Unmarshal(data, &model)
+	if err != nil {
+		return err
+	}
+	var snapshot struct {
+		Optimizer *Optimizer `json:"optimizer"`
+	}
+	if err = json.Unmarshal(data, &snapshot); err != nil {
+		return err
+	}
+	optimizer := e.optimizer.reset()
+	if snapshot.Optimizer != nil {
+		optimizer = snapshot.Optimizer
+		if err = optimizer.Check(e.learner.learnables()); err != nil {
+			return err
+		}
+	}
+	if err = e.Model.assign(&model); err != nil {
+		return err
+	}
+	e.optimizer = optimizer
+	return nil
+}
+
+// Weights returns the weights of the nodes by name
+func Weights(nodes G.Nodes) map[string][]float32 {
+	weights := make(map[string][]float32, len(nodes))
+	for _, node := range nodes {
+		weights[node.Name()] = node.Value().Data().([]float32)
+	}
+	return weights
+}
+
+// SetWeights copies weights by name into the values of the nodes, there must
+// be a weight of the same size for each node. Nothing is copied if there
+// isn't
+func SetWeights(nodes G.Nodes, weights map[string][]float32) error {
+	if len(weights) != len(nodes) {
+		return fmt.Errorf("%d weights, not %d", len(weights), len(nodes))
+	}
+	for _, node := range nodes {
+		weight, ok := weights[node.Name()]
+		if !ok {
+			return fmt.Errorf("weight %q is missing", node.Name())
+		}
+		if size := len(node.Value().Data().([]float32)); len(weight) != size {
+			return fmt.Errorf("weight %q has %d values, not %d", node.Name(), len(weight), size)
+		}
+	}
+	for _, node := range nodes {
+		copy(node.Value().Data().([]float32), weights[node.Name()])
+	}
+	return nil
+}
+
+// bidirectionalJSON is the JSON form of a bidirectional engine
+type bidirectionalJSON struct {
+	Weights   map[string][]float32 `json:"weights"`
+	Optimizer *Optimizer           `json:"optimizer"`
+}
+
+// MarshalJSON encodes the weights and the optimizer of the bidirectional
+// engine as JSON
+func (b *Bidirectional) MarshalJSON() ([]byte, error) {
+	return json.Marshal(bidirectionalJSON{
+		Weights:   Weights(b.learner.learnables),
+		Optimizer: b.optimizer,
+	})
+}
+
+// UnmarshalJSON decodes the weights and the optimizer of the bidirectional
+// engine from JSON, the weights must have the sizes of the engine
+func (b *Bidirectional) UnmarshalJSON(data []byte) error {
+	var snapshot bidirectionalJSON
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return err
+	}
+	if snapshot.Optimizer == nil {
+		return errors.New("bidirectional engine has no optimizer")
+	}
+	if err = snapshot.Optimizer.Check(b.learner.learnables); err != nil {
+		return err
+	}
+	if err = SetWeights(b.learner.learnables, snapshot.Weights); err != nil {
+		return err
+	}
+	b.optimizer = snapshot.Optimizer
+	return nil
+}
+
+// Checkpoint is a snapshot of the training of a model, the optimizer keeps
+// its running averages so training resumes where it stopped. A checkpoint
+// without an optimizer starts them over
+type Checkpoint struct {
+	Iteration  int         `json:"iteration"`
+	Options    Options     `json:"options"`
+	Vocabulary *Vocabulary `json:"vocabulary"`
+	Model      *Model      `json:"model"`
+	Optimizer  *Optimizer  `json:"optimizer,omitempty"`
+}
+
+// Save writes the checkpoint to a file, the file is replaced only once the
+// checkpoint has been written
+func (c *Checkpoint) Save(name string) error {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	temp := name + ".tmp"
+	err = ioutil.WriteFile(temp, data, 0644)
+	if err != nil {
+		return err
+	}
+	return os.Rename(temp, name)
+}
+
+// LoadCheckpoint reads a checkpoint from a file
+func LoadCheckpoint(name string) (*Checkpoint, error) {
+	data, err := ioutil.ReadFile(name)
+	if err != nil {
+		return nil, err
+	}
+	var checkpoint Checkpoint
+	err = json.Unmarshal(data, &checkpoint)
+	if err != nil {
+		return nil, err
+	}
+	if checkpoint.Model == nil || checkpoint.Vocabulary == nil {
+		return nil, fmt.Errorf("checkpoint %s has no model or vocabulary", name)
+	}
+	return &checkpoint, nil
+}
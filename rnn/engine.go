@@ -0,0 +1,110 @@
+package rnn
+
+import (
+	"fmt"
+	"math/rand"
+)
+
+// Engine is an anomaly detection engine built on a recurrent neural network
+type Engine struct {
+	*Model
+	learner   *CharRNN
+	optimizer *Optimizer
+	tokenizer Tokenizer
+	stateful  bool
+}
+
+// NewEngine creates a new anomaly detection engine with layers of the given
+// cell and the given hyperparameters, it panics if the options aren't valid
+func NewEngine(rnd *rand.Rand, cell Cell, options Options) *Engine {
+	if err := options.Validate(); err != nil {
+		panic(err)
+	}
+	tokenizer := options.Tokenizer
+	if tokenizer == nil {
+		tokenizer = ByteTokenizer{}
+	}
+	vocabulary := NewVocabularyFromRange(0, rune(tokenizer.Size()))
+
+	inputSize := len(vocabulary.List)
+	outputSize := len(vocabulary.List)
+	model := NewModel(rnd, cell, inputSize, options.EmbeddingSize, outputSize, options.HiddenSizes)
+
+	learner := NewCharRNN(model, vocabulary)
+	err := learner.ModeLearn(options.Steps)
+	if err != nil {
+		panic(err)
+	}
+
+	return &Engine{
+		Model:     model,
+		learner:   learner,
+		optimizer: options.NewOptimizer(),
+		tokenizer: tokenizer,
+		stateful:  options.Stateful,
+	}
+}
+
+// Costs computes the cost of predicting each symbol of the input from the
+// symbols before it
+func (e *Engine) Costs(input []byte) []float32 {
+	symbols, _ := e.tokenizer.Encode(input)
+	return e.costs(symbols)
+}
+
+// Cost computes the cost of the input
+func (e *Engine) Cost(input []byte) float32 {
+	var cost float32
+	for _, c := range e.Costs(input) {
+		cost += c
+	}
+	return cost
+}
+
+// Embed computes the embedding of the input without learning
+func (e *Engine) Embed(input []byte, pooling Pooling) []float32 {
+	symbols, _ := e.tokenizer.Encode(input)
+	return e.embed(symbols, pooling)
+}
+
+// Profile computes the surprise of each byte of the input, the surprise of a
+// symbol is spread over its bytes and the first symbol isn't predicted and
+// has no surprise
+func (e *Engine) Profile(input []byte) []float32 {
+	profile := make([]float32, len(input))
+	symbols, ends := e.tokenizer.Encode(input)
+	for i, cost := range e.costs(symbols) {
+		begin, end := ends[i], ends[i+1]
+		for j := begin; j < end; j++ {
+			profile[j] = cost / float32(end-begin)
+		}
+	}
+	return profile
+}
+
+// Score computes the surprise without learning
+func (e *Engine) Score(input []byte) (surprise, uncertainty float32) {
+	return e.Cost(input) / float32(len(input)), 0
+}
+
+// Train trains the recurrent neural network
+func (e *Engine) Train(input []byte) (surprise, uncertainty float32) {
+	cost := e.Cost(input)
+
+	symbols, _ := e.tokenizer.Encode(input)
+	data := make([]rune, len(symbols))
+	for i, v := range symbols {
+		data[i] = rune(v)
+	}
+	var err error
+	if e.stateful {
+		_, _, err = e.learner.LearnStateful(data, e.optimizer)
+	} else {
+		_, _, err = e.learner.Learn(data, 0, e.optimizer)
+	}
+	if err != nil {
+		panic(fmt.Sprintf("%+v", err))
+	}
+
+	return float32(cost) / float32(len(input)), 0
+}
@@ -0,0 +1,154 @@
+package rnn
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+)
+
+// Generation controls the generation of symbols by a model
+type Generation struct {
+	// Prompt is the prefix the generated symbols continue, an empty prompt
+	// starts from the first symbol of the vocabulary
+	Prompt []rune
+	// Temperature scales the logits before sampling, a temperature of 0
+	// always picks the most likely symbol
+	Temperature float64
+	// TopK limits sampling to the k most likely symbols, 0 doesn't limit
+	// sampling
+	TopK int
+	// MaxLength is the maximum number of symbols generated
+	MaxLength int
+	// Stop ends generation when it returns true for the prompt followed by
+	// the generated symbols
+	Stop func(text []rune) bool
+}
+
+// StopBalanced stops generation once the brackets and braces of a JSON
+// document are balanced
+func StopBalanced(text []rune) bool {
+	depth, opened, quoted, escaped := 0, false, false, false
+	for _, r := range text {
+		switch {
+		case escaped:
+			escaped = false
+		case quoted && r == '\\':
+			escaped = true
+		case r == '"':
+			quoted = !quoted
+		case quoted:
+		case r == '{' || r == '[':
+			depth++
+			opened = true
+		case r == '}' || r == ']':
+			depth--
+		}
+	}
+	return opened && depth <= 0
+}
+
+// choose picks the next symbol given its logits
+func (g *Generation) choose(rnd *rand.Rand, logits []float32) int {
+	if g.Temperature <= 0 {
+		max := 0
+		for i, v := range logits {
+			if v > logits[max] {
+				max = i
+			}
+		}
+		return max
+	}
+
+	candidates := make([]int, len(logits))
+	for i := range candidates {
+		candidates[i] = i
+	}
+	if g.TopK > 0 && g.TopK < len(candidates) {
+		sort.Slice(candidates, func(i, j int) bool {
+			return logits[candidates[i]] > logits[candidates[j]]
+		})
+		candidates = candidates[:g.TopK]
+	}
+
+	max := logits[candidates[0]]
+	for _, c := range candidates {
+		if logits[c] > max {
+			max = logits[c]
+		}
+	}
+	weights, sum := make([]float64, len(candidates)), 0.0
+	for i, c := range candidates {
+		weights[i] = math.Exp(float64(logits[c]-max) / g.Temperature)
+		sum += weights[i]
+	}
+	selected := rnd.Float64() * sum
+	for i, weight := range weights {
+		selected -= weight
+		if selected < 0 {
+			return candidates[i]
+		}
+	}
+	return candidates[len(candidates)-1]
+}
+
+// generate generates symbols following the prompt symbols. Generation ends at
+// the end symbol, when stop returns true for the prompt followed by the
+// generated symbols or at MaxLength symbols
+func (m *Model) generate(rnd *rand.Rand, g *Generation, prompt []int, end int, stop func(symbols []int) bool) []int {
+	s := m.newState()
+	if len(prompt) == 0 {
+		s.step(0)
+	}
+	for _, symbol := range prompt {
+		s.step(symbol)
+	}
+
+	symbols := append([]int(nil), prompt...)
+	logits := make([]float32, m.outputSize)
+	for i := 0; i < g.MaxLength; i++ {
+		s.logits(logits)
+		symbol := g.choose(rnd, logits)
+		if symbol == end {
+			break
+		}
+		symbols = append(symbols, symbol)
+		if g.Stop != nil && stop(symbols) {
+			break
+		}
+		s.step(symbol)
+	}
+	return symbols[len(prompt):]
+}
+
+// Generate generates symbols following a prompt with the current weights of
+// the model. Generation ends at the END symbol, when Stop returns true or at
+// MaxLength symbols. The prompt isn't part of the returned symbols
+func (r *CharRNN) Generate(rnd *rand.Rand, g Generation) []rune {
+	prompt := make([]int, len(g.Prompt))
+	for i, symbol := range g.Prompt {
+		prompt[i] = r.Symbol(symbol)
+	}
+	end, ok := r.Index[END]
+	if !ok {
+		end = -1
+	}
+	text := func(symbols []int) []rune {
+		runes := make([]rune, len(symbols))
+		for i, symbol := range symbols {
+			runes[i] = r.List[symbol]
+		}
+		return runes
+	}
+	return text(r.generate(rnd, &g, prompt, end, func(symbols []int) bool {
+		return g.Stop(text(symbols))
+	}))
+}
+
+// Generate generates bytes following a prompt with the current weights of
+// the model. Generation ends when Stop returns true or at MaxLength symbols
+func (e *Engine) Generate(rnd *rand.Rand, g Generation) []byte {
+	prompt, _ := e.tokenizer.Encode([]byte(string(g.Prompt)))
+	return e.tokenizer.Decode(e.generate(rnd, &g, prompt, -1, func(symbols []int) bool {
+		return g.Stop([]rune(string(e.tokenizer.Decode(symbols))))
+	}))
+}
@@ -0,0 +1,274 @@
+package rnn
+
+import (
+	"math"
+
+	"gorgonia.org/tensor"
+)
+
+// sigmoid is the logistic function
+func sigmoid(x float32) float32 {
+	return float32(1 / (1 + math.Exp(-float64(x))))
+}
+
+// tanh is the hyperbolic tangent
+func tanh(x float32) float32 {
+	return float32(math.Tanh(float64(x)))
+}
+
+// relu is the rectified linear function
+func relu(x float32) float32 {
+	if x < 0 {
+		return 0
+	}
+	return x
+}
+
+// mulVec adds the product of a matrix and a vector to y
+func mulVec(m *tensor.Dense, x, y []float32) {
+	data, cols := m.Data().([]float32), m.Shape()[1]
+	for i := range y {
+		sum, row := float32(0), data[i*cols:(i+1)*cols]
+		for j, v := range row {
+			sum += v * x[j]
+		}
+		y[i] += sum
+	}
+}
+
+// affine computes activation(w*x + u*h + b)
+func affine(activation func(float32) float32, w, u, b *tensor.Dense, x, h []float32) []float32 {
+	y := make([]float32, len(h))
+	copy(y, b.Data().([]float32))
+	mulVec(w, x, y)
+	mulVec(u, h, y)
+	for i, v := range y {
+		y[i] = activation(v)
+	}
+	return y
+}
+
+// Step computes the next hidden and cell states without a graph
+func (LSTM) Step(w []Weight, input []float32, states [][]float32) {
+	hidden, cell := states[0], states[1]
+	inputGate := affine(sigmoid, w[0].Value, w[1].Value, w[2].Value, input, hidden)
+	forgetGate := affine(sigmoid, w[3].Value, w[4].Value, w[5].Value, input, hidden)
+	outputGate := affine(sigmoid, w[6].Value, w[7].Value, w[8].Value, input, hidden)
+	cellWrite := affine(tanh, w[9].Value, w[10].Value, w[11].Value, input, hidden)
+	for i := range cell {
+		cell[i] = forgetGate[i]*cell[i] + inputGate[i]*cellWrite[i]
+		hidden[i] = outputGate[i] * tanh(cell[i])
+	}
+}
+
+// Step computes the next hidden state without a graph
+func (GRU) Step(w []Weight, input []float32, states [][]float32) {
+	previous := states[0]
+	f := affine(sigmoid, w[0].Value, w[1].Value, w[2].Value, input, previous)
+	reset := make([]float32, len(previous))
+	for i, v := range previous {
+		reset[i] = f[i] * v
+	}
+	z := affine(tanh, w[3].Value, w[4].Value, w[5].Value, input, reset)
+	for i := range previous {
+		previous[i] = (1-f[i])*z[i] + f[i]*previous[i]
+	}
+}
+
+// Step computes the next hidden state without a graph
+func (Elman) Step(w []Weight, input []float32, states [][]float32) {
+	copy(states[0], affine(tanh, w[0].Value, w[1].Value, w[2].Value, input, states[0]))
+}
+
+// Step computes the next hidden state without a graph
+func (MGU) Step(w []Weight, input []float32, states [][]float32) {
+	previous := states[0]
+	f := affine(sigmoid, w[0].Value, w[1].Value, w[2].Value, input, previous)
+	reset := make([]float32, len(previous))
+	for i, v := range previous {
+		reset[i] = f[i] * v
+	}
+	candidate := affine(tanh, w[3].Value, w[4].Value, w[5].Value, input, reset)
+	for i := range previous {
+		previous[i] = (1-f[i])*previous[i] + f[i]*candidate[i]
+	}
+}
+
+// Step computes the next hidden state without a graph
+func (IndRNN) Step(w []Weight, input []float32, states [][]float32) {
+	hidden := states[0]
+	y := make([]float32, len(hidden))
+	copy(y, w[2].Value.Data().([]float32))
+	mulVec(w[0].Value, input, y)
+	for i, u := range w[1].Value.Data().([]float32) {
+		hidden[i] = relu(y[i] + u*hidden[i])
+	}
+}
+
+// state is the state of a model processing symbols without a graph
+type state struct {
+	*Model
+	states [][][]float32
+	vector []float32
+}
+
+// newState creates the initial state of the model
+func (m *Model) newState() *state {
+	states := make([][][]float32, len(m.layers))
+	for i, size := range m.hiddenSizes {
+		states[i] = make([][]float32, m.cell.States())
+		for j := range states[i] {
+			states[i][j] = make([]float32, size)
+		}
+	}
+	return &state{
+		Model:  m,
+		states: states,
+		vector: make([]float32, m.embeddingSize),
+	}
+}
+
+// step runs a symbol through the layers of the model
+func (s *state) step(symbol int) {
+	embedding := s.embedding.Data().([]float32)
+	for j := range s.vector {
+		s.vector[j] = embedding[j*s.inputSize+symbol]
+	}
+	x := s.vector
+	for j, weights := range s.layers {
+		s.cell.Step(weights, x, s.states[j])
+		x = s.states[j][0]
+	}
+}
+
+// logits computes the logits of the next symbol
+func (s *state) logits(logits []float32) {
+	copy(logits, s.biasD.Data().([]float32))
+	mulVec(s.whd, s.states[len(s.states)-1][0], logits)
+}
+
+// forward runs the symbols through the layers of the model without a graph,
+// calling visit with the state after each symbol
+func (m *Model) forward(symbols []int, visit func(i int, s *state)) {
+	s := m.newState()
+	for i, symbol := range symbols {
+		s.step(symbol)
+		visit(i, s)
+	}
+}
+
+// byteSymbols converts bytes into symbols
+func byteSymbols(input []byte) []int {
+	output := make([]int, len(input))
+	for i, v := range input {
+		output[i] = int(v)
+	}
+	return output
+}
+
+// costs computes the cost of predicting each symbol from the symbols before it
+func (m *Model) costs(symbols []int) []float32 {
+	if len(symbols) < 2 {
+		return nil
+	}
+	logits := make([]float32, m.outputSize)
+	costs := make([]float32, 0, len(symbols)-1)
+	m.forward(symbols[:len(symbols)-1], func(i int, s *state) {
+		s.logits(logits)
+		max := logits[0]
+		for _, v := range logits {
+			if v > max {
+				max = v
+			}
+		}
+		sum := 0.0
+		for _, v := range logits {
+			sum += math.Exp(float64(v - max))
+		}
+		costs = append(costs, float32(math.Log(sum))-(logits[symbols[i+1]]-max))
+	})
+	return costs
+}
+
+// Costs computes the cost of predicting each symbol of the input from the
+// symbols before it with the current weights of the model. The computation
+// is done without a graph and is the same as that of a CharRNN in inference
+// mode
+func (m *Model) Costs(input []byte) []float32 {
+	return m.costs(byteSymbols(input))
+}
+
+// Cost computes the cost of the input with the current weights of the model
+func (m *Model) Cost(input []byte) float32 {
+	var cost float32
+	for _, c := range m.Costs(input) {
+		cost += c
+	}
+	return cost
+}
+
+// Pooling is a way of pooling the states of a document into an embedding
+type Pooling int
+
+const (
+	// PoolingLast uses the states after the last symbol
+	PoolingLast Pooling = iota
+	// PoolingMean uses the mean of the states after each symbol
+	PoolingMean
+)
+
+// StateSize is the size of the embeddings of the model
+func (m *Model) StateSize() int {
+	return m.cell.States() * m.hiddenSizes[len(m.hiddenSizes)-1]
+}
+
+// Embed runs the input through the model without learning and returns the
+// states of the last layer, the hidden state followed by any other states of
+// the cell, as an embedding of the input
+func (m *Model) Embed(input []byte, pooling Pooling) []float32 {
+	return m.embed(byteSymbols(input), pooling)
+}
+
+// embed pools the states of the last layer after each symbol
+func (m *Model) embed(symbols []int, pooling Pooling) []float32 {
+	embedding := make([]float32, m.StateSize())
+	m.forward(symbols, func(i int, s *state) {
+		last, offset := s.states[len(s.states)-1], 0
+		for _, state := range last {
+			for j, v := range state {
+				if pooling == PoolingMean {
+					embedding[offset+j] += v
+				} else {
+					embedding[offset+j] = v
+				}
+			}
+			offset += len(state)
+		}
+	})
+	if pooling == PoolingMean && len(symbols) > 0 {
+		for i := range embedding {
+			embedding[i] /= float32(len(symbols))
+		}
+	}
+	return embedding
+}
+
+// Perplexity computes the perplexity per symbol of the sentences with the
+// current weights of the model
+func (r *CharRNN) Perplexity(sentences [][]rune) float64 {
+	cost, count := 0.0, 0
+	for _, sentence := range sentences {
+		symbols := make([]int, len(sentence))
+		for i, v := range sentence {
+			symbols[i] = r.Symbol(v)
+		}
+		for _, c := range r.costs(symbols) {
+			cost += float64(c)
+			count++
+		}
+	}
+	if count == 0 {
+		return 0
+	}
+	return math.Exp(cost / float64(count))
+}
@@ -0,0 +1,459 @@
+package rnn
+
+import (
+	"fmt"
+	"io/ioutil"
+	"math"
+	"math/rand"
+	"strconv"
+
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// prediction params
+var softmaxTemperature = 1.0
+var maxCharGen = 100
+
+type contextualError interface {
+	error
+	Node() *G.Node
+	Value() G.Value
+	InstructionID() int
+}
+
+// Model is a recurrent neural network with layers of cells
+type Model struct {
+	cell   Cell
+	layers [][]Weight
+
+	// decoder
+	whd   *tensor.Dense
+	biasD *tensor.Dense
+
+	embedding *tensor.Dense
+
+	// metadata
+	inputSize, embeddingSize, outputSize int
+	hiddenSizes                          []int
+}
+
+type rnnOut struct {
+	states []G.Nodes
+	values [][]G.Value
+	probs  *G.Node
+}
+
+// read keeps the values of the states, which would otherwise be overwritten
+// in place when the states aren't inputs to another step
+func (o *rnnOut) read() {
+	o.values = make([][]G.Value, len(o.states))
+	for i, states := range o.states {
+		o.values[i] = make([]G.Value, len(states))
+		for j, state := range states {
+			G.Read(state, &o.values[i][j])
+		}
+	}
+}
+
+// NewModel creates a new model with layers of the given cell
+func NewModel(rnd *rand.Rand, cell Cell, inputSize, embeddingSize, outputSize int, hiddenSizes []int) *Model {
+	m := &Model{
+		cell:          cell,
+		inputSize:     inputSize,
+		embeddingSize: embeddingSize,
+		outputSize:    outputSize,
+		hiddenSizes:   hiddenSizes,
+	}
+
+	last := false
+	if cell, ok := cell.(embeddingLast); ok {
+		last = cell.EmbeddingLast()
+	}
+	newEmbedding := func() {
+		m.embedding = tensor.New(tensor.WithShape(embeddingSize, inputSize),
+			tensor.WithBacking(gaussian32(rnd, embeddingSize, inputSize)))
+	}
+	if !last {
+		newEmbedding()
+	}
+
+	previous := embeddingSize
+	for _, size := range hiddenSizes {
+		m.layers = append(m.layers, cell.Weights(rnd, previous, size))
+		previous = size
+	}
+
+	m.whd = tensor.New(tensor.WithShape(outputSize, previous),
+		tensor.WithBacking(gaussian32(rnd, outputSize, previous)))
+	m.biasD = tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(outputSize))
+
+	if last {
+		newEmbedding()
+	}
+	return m
+}
+
+// CharRNN is a recurrent neural network that takes characters as input
+type CharRNN struct {
+	*Model
+	*Vocabulary
+
+	g      *G.ExprGraph
+	layers []G.Nodes
+
+	// decoder
+	whd   *G.Node
+	biasD *G.Node
+
+	embedding *G.Node
+
+	states []G.Nodes
+
+	steps            int
+	inputs           []*tensor.Dense
+	outputs          []*tensor.Dense
+	previous         []*rnnOut
+	cost, perplexity *G.Node
+	machine          G.VM
+}
+
+// NewCharRNN create a new recurrent neural network for characters as inputs
+func NewCharRNN(m *Model, vocabulary *Vocabulary) *CharRNN {
+	r := &CharRNN{
+		Model:      m,
+		Vocabulary: vocabulary,
+		g:          G.NewGraph(),
+	}
+
+	for depth, weights := range m.layers {
+		hiddenSize := m.hiddenSizes[depth]
+		layerID := strconv.Itoa(depth)
+		nodes := make(G.Nodes, len(weights))
+		for i, weight := range weights {
+			nodes[i] = G.NodeFromAny(r.g, weight.Value, G.WithName(weight.Name+"_"+layerID))
+		}
+		r.layers = append(r.layers, nodes)
+
+		// this is to simulate a default "previous" state
+		states := make(G.Nodes, m.cell.States())
+		for i := range states {
+			stateT := tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(hiddenSize))
+			states[i] = G.NewVector(r.g, G.Float32, G.WithName(fmt.Sprintf("prevState%d_%s", i, layerID)),
+				G.WithShape(hiddenSize), G.WithValue(stateT))
+		}
+		r.states = append(r.states, states)
+	}
+	r.whd = G.NodeFromAny(r.g, m.whd, G.WithName("whd"))
+	r.biasD = G.NodeFromAny(r.g, m.biasD, G.WithName("bias_d"))
+	r.embedding = G.NodeFromAny(r.g, m.embedding, G.WithName("Embedding"))
+
+	return r
+}
+
+func (r *CharRNN) learnables() (retVal G.Nodes) {
+	for _, l := range r.layers {
+		retVal = append(retVal, l...)
+	}
+
+	retVal = append(retVal, r.whd)
+	retVal = append(retVal, r.biasD)
+	retVal = append(retVal, r.embedding)
+	return
+}
+
+func (r *CharRNN) fwd(step int, prev *rnnOut) (inputTensor *tensor.Dense, retVal *rnnOut, err error) {
+	prevStates := r.states
+	if prev != nil {
+		prevStates = prev.states
+	}
+
+	var states []G.Nodes
+	for i, l := range r.layers {
+		var inputVector *G.Node
+		if i == 0 {
+			inputTensor = tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(r.inputSize))
+			// inputs are named, nodes without a name are deduplicated by shape
+			input := G.NewVector(r.g, tensor.Float32, G.WithName("input_"+strconv.Itoa(step)),
+				G.WithShape(r.inputSize), G.WithValue(inputTensor))
+			inputVector = G.Must(G.Mul(r.embedding, input))
+		} else {
+			inputVector = states[i-1][0]
+		}
+
+		states = append(states, r.cell.Forward(l, inputVector, prevStates[i]))
+	}
+	lastHidden := states[len(states)-1][0]
+	var out *G.Node
+	if out, err = G.Mul(r.whd, lastHidden); err == nil {
+		if out, err = G.Add(out, r.biasD); err != nil {
+			G.WithName("LAST HIDDEN")(lastHidden)
+			ioutil.WriteFile("err.dot", []byte(lastHidden.RestrictedToDot(3, 10)), 0644)
+			panic(fmt.Sprintf("ERROR: %v", err))
+		}
+	}
+
+	var probs *G.Node
+	probs = G.Must(G.SoftMax(out))
+
+	retVal = &rnnOut{
+		states: states,
+		probs:  probs,
+	}
+	return
+}
+
+func (r *CharRNN) feedback(tap int) {
+	prev := r.previous[tap]
+	for i, states := range r.states {
+		for j := range states {
+			input := states[j].Value().(*tensor.Dense)
+			value := prev.states[i][j].Value()
+			if prev.values != nil {
+				value = prev.values[i][j]
+			}
+			err := value.(*tensor.Dense).CopyTo(input)
+			if err != nil {
+				panic(err)
+			}
+		}
+	}
+}
+
+func (r *CharRNN) reset() {
+	for _, states := range r.states {
+		for _, state := range states {
+			state.Value().(*tensor.Dense).Zero()
+		}
+	}
+}
+
+// ModeLearn puts the CharRNN into a learning mode
+func (r *CharRNN) ModeLearn(steps int) (err error) {
+	inputs := make([]*tensor.Dense, steps-1)
+	outputs := make([]*tensor.Dense, steps-1)
+	previous := make([]*rnnOut, steps-1)
+	var cost, perplexity *G.Node
+
+	for i := 0; i < steps-1; i++ {
+		var loss, perp *G.Node
+
+		var prev *rnnOut
+		if i > 0 {
+			prev = previous[i-1]
+		}
+		inputs[i], previous[i], err = r.fwd(i, prev)
+		if err != nil {
+			return
+		}
+
+		logprob := G.Must(G.Neg(G.Must(G.Log(previous[i].probs))))
+		outputs[i] = tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(r.outputSize))
+		output := G.NewVector(r.g, tensor.Float32, G.WithName("output_"+strconv.Itoa(i)),
+			G.WithShape(r.outputSize), G.WithValue(outputs[i]))
+		loss = G.Must(G.Mul(logprob, output))
+		log2prob := G.Must(G.Neg(G.Must(G.Log2(previous[i].probs))))
+		perp = G.Must(G.Mul(log2prob, output))
+
+		if cost == nil {
+			cost = loss
+		} else {
+			cost = G.Must(G.Add(cost, loss))
+		}
+		G.WithName("Cost")(cost)
+
+		if perplexity == nil {
+			perplexity = perp
+		} else {
+			perplexity = G.Must(G.Add(perplexity, perp))
+		}
+	}
+
+	r.steps = steps
+	r.inputs = inputs
+	r.outputs = outputs
+	r.previous = previous
+	r.cost = cost
+	r.perplexity = perplexity
+
+	previous[len(previous)-1].read()
+
+	_, err = G.Grad(cost, r.learnables()...)
+	if err != nil {
+		return
+	}
+
+	r.machine = G.NewTapeMachine(r.g, G.BindDualValues(r.learnables()...))
+	return
+}
+
+// ModeInference puts the CharRNN into inference mode
+func (r *CharRNN) ModeInference() (err error) {
+	inputs := make([]*tensor.Dense, 1)
+	outputs := make([]*tensor.Dense, 1)
+
+	previous := make([]*rnnOut, 1)
+	inputs[0], previous[0], err = r.fwd(0, nil)
+	if err != nil {
+		return
+	}
+	previous[0].read()
+	logprob := G.Must(G.Neg(G.Must(G.Log(previous[0].probs))))
+	outputs[0] = tensor.New(tensor.Of(tensor.Float32), tensor.WithShape(r.outputSize))
+	output := G.NewVector(r.g, tensor.Float32, G.WithName("output_0"),
+		G.WithShape(r.outputSize), G.WithValue(outputs[0]))
+	cost := G.Must(G.Mul(logprob, output))
+
+	r.inputs = inputs
+	r.outputs = outputs
+	r.previous = previous
+	r.cost = cost
+	r.machine = G.NewTapeMachine(r.g)
+	return
+}
+
+// ModeInferencePredict puts the CharRNN into inference prediction mode
+func (r *CharRNN) ModeInferencePredict() (err error) {
+	inputs := make([]*tensor.Dense, 1)
+	previous := make([]*rnnOut, 1)
+
+	inputs[0], previous[0], err = r.fwd(0, nil)
+	if err != nil {
+		return
+	}
+	previous[0].read()
+
+	r.inputs = inputs
+	r.previous = previous
+	r.machine = G.NewTapeMachine(r.g)
+	return
+}
+
+// Predict prints a sampled and an argmax string generated with the current
+// weights of the model
+func (r *CharRNN) Predict() {
+	rnd := rand.New(rand.NewSource(rand.Int63()))
+	sampled := r.Generate(rnd, Generation{
+		Temperature: softmaxTemperature,
+		MaxLength:   maxCharGen,
+	})
+	argmax := r.Generate(rnd, Generation{
+		MaxLength: maxCharGen,
+	})
+	fmt.Printf("Sampled: %q; \nArgMax: %q\n", string(sampled), string(argmax))
+}
+
+// graphCosts computes the costs of Model.Costs with the graph of a CharRNN in
+// inference mode
+func (r *CharRNN) graphCosts(input []byte) []float32 {
+	costs := make([]float32, 0, len(input))
+	r.reset()
+	for i := range input[:len(input)-1] {
+		r.inputs[0].Zero()
+		r.inputs[0].SetF32(int(input[i]), 1.0)
+		r.outputs[0].Zero()
+		r.outputs[0].SetF32(int(input[i+1]), 1.0)
+		err := r.machine.RunAll()
+		if err != nil {
+			panic(err)
+		}
+		var cost float32
+		if cv, ok := r.cost.Value().(G.Scalar); ok {
+			cost = cv.Data().(float32)
+		}
+		costs = append(costs, cost)
+		r.feedback(0)
+		r.machine.Reset()
+	}
+	return costs
+}
+
+// Learn learns strings
+func (r *CharRNN) Learn(sentence []rune, iter int, optimizer *Optimizer) (retCost, retPerp []float64, err error) {
+	n := len(sentence)
+
+	r.reset()
+	steps := r.steps - 1
+	for x := 0; x < n-steps; x++ {
+		for j := 0; j < steps; j++ {
+			source := sentence[x+j]
+			target := sentence[x+j+1]
+
+			r.inputs[j].Zero()
+			r.inputs[j].SetF32(r.Symbol(source), 1.0)
+			r.outputs[j].Zero()
+			r.outputs[j].SetF32(r.Symbol(target), 1.0)
+		}
+
+		if err = r.machine.RunAll(); err != nil {
+			if ctxerr, ok := err.(contextualError); ok {
+				ioutil.WriteFile("FAIL.dot", []byte(ctxerr.Node().RestrictedToDot(3, 3)), 0644)
+
+			}
+			return
+		}
+
+		err = optimizer.Update(r.learnables())
+		if err != nil {
+			return
+		}
+
+		if sv, ok := r.perplexity.Value().(G.Scalar); ok {
+			v := sv.Data().(float32)
+			retPerp = append(retPerp, math.Pow(2, float64(v)/(float64(n)-1)))
+		}
+		if cv, ok := r.cost.Value().(G.Scalar); ok {
+			retCost = append(retCost, float64(cv.Data().(float32)))
+		}
+		r.feedback(0)
+		r.machine.Reset()
+	}
+
+	return
+}
+
+// LearnStateful learns strings with truncated backpropagation through time.
+// The string is learned from in non-overlapping chunks of steps-1 symbols and
+// the states are carried from one chunk to the next, the last chunk is padded
+func (r *CharRNN) LearnStateful(sentence []rune, optimizer *Optimizer) (retCost, retPerp []float64, err error) {
+	n := len(sentence)
+
+	r.reset()
+	steps := r.steps - 1
+	for x := 0; x < n-1; x += steps {
+		count := 0
+		for j := 0; j < steps; j++ {
+			r.inputs[j].Zero()
+			r.outputs[j].Zero()
+			if x+j+1 < n {
+				r.inputs[j].SetF32(r.Symbol(sentence[x+j]), 1.0)
+				r.outputs[j].SetF32(r.Symbol(sentence[x+j+1]), 1.0)
+				count++
+			}
+		}
+
+		if err = r.machine.RunAll(); err != nil {
+			if ctxerr, ok := err.(contextualError); ok {
+				ioutil.WriteFile("FAIL.dot", []byte(ctxerr.Node().RestrictedToDot(3, 3)), 0644)
+			}
+			return
+		}
+
+		err = optimizer.Update(r.learnables())
+		if err != nil {
+			return
+		}
+
+		if sv, ok := r.perplexity.Value().(G.Scalar); ok {
+			v := sv.Data().(float32)
+			retPerp = append(retPerp, math.Pow(2, float64(v)/float64(count)))
+		}
+		if cv, ok := r.cost.Value().(G.Scalar); ok {
+			retCost = append(retCost, float64(cv.Data().(float32)))
+		}
+		r.feedback(steps - 1)
+		r.machine.Reset()
+	}
+
+	return
+}
@@ -0,0 +1,123 @@
+package rnn
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// Solver is a type of solver for learning
+type Solver int
+
+const (
+	// SolverRMSProp is the RMSProp solver
+	SolverRMSProp Solver = iota
+	// SolverAdam is the Adam solver
+	SolverAdam
+	// SolverMomentum is stochastic gradient descent with momentum
+	SolverMomentum
+)
+
+// Options are the hyperparameters of a recurrent neural network
+type Options struct {
+	// Steps is the length of the sequences learned from
+	Steps int
+	// Stateful learns from non-overlapping chunks of Steps-1 bytes and
+	// carries the states across chunks instead of sliding over the bytes
+	Stateful bool
+	// Tokenizer splits documents into symbols, the default is a symbol per
+	// byte. It is encoded as JSON by its type and vocabulary
+	Tokenizer     Tokenizer `json:"-"`
+	EmbeddingSize int
+	HiddenSizes   []int
+
+	Solver    Solver
+	LearnRate float64
+	L2Reg     float64
+	// Clip is the magnitude each gradient is clipped to before a step of
+	// any solver, 0 doesn't clip
+	Clip     float64
+	Momentum float64
+}
+
+// DefaultOptions returns the default hyperparameters of a recurrent neural network
+func DefaultOptions() Options {
+	return Options{
+		Steps:         4,
+		EmbeddingSize: 10,
+		HiddenSizes:   []int{10},
+		Solver:        SolverRMSProp,
+		LearnRate:     0.01,
+		L2Reg:         0.000001,
+		Clip:          5.0,
+		Momentum:      0.9,
+	}
+}
+
+// BidirectionalSteps is the default size of the windows of the bidirectional
+// engine. A symbol is only predicted from the other symbols of its window, so
+// the windows are much longer than the default Steps
+const BidirectionalSteps = 32
+
+// DefaultBidirectionalOptions returns the default hyperparameters of a
+// bidirectional recurrent neural network
+func DefaultBidirectionalOptions() Options {
+	options := DefaultOptions()
+	options.Steps = BidirectionalSteps
+	return options
+}
+
+// ErrSteps is returned for options with fewer than 2 steps, a step is
+// learned from the symbol before it
+var ErrSteps = errors.New("steps must be at least 2")
+
+// ErrSizes is returned for options without hidden layers or with a size
+// below 1
+var ErrSizes = errors.New("embedding and hidden sizes must be at least 1")
+
+// Validate checks the options
+func (o *Options) Validate() error {
+	if o.Steps < 2 {
+		return ErrSteps
+	}
+	if o.EmbeddingSize < 1 || len(o.HiddenSizes) == 0 {
+		return ErrSizes
+	}
+	for _, size := range o.HiddenSizes {
+		if size < 1 {
+			return ErrSizes
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the options as JSON with the tokenizer
+func (o Options) MarshalJSON() ([]byte, error) {
+	type options Options
+	tokenizer, err := newTokenizerJSON(o.Tokenizer)
+	if err != nil {
+		return nil, err
+	}
+	return json.Marshal(struct {
+		options
+		Tokenizer *tokenizerJSON `json:",omitempty"`
+	}{options(o), tokenizer})
+}
+
+// UnmarshalJSON decodes options and their tokenizer from JSON into o, options
+// that aren't in the JSON keep their values and unknown options are an error
+func (o *Options) UnmarshalJSON(data []byte) error {
+	type options Options
+	decoded := struct {
+		*options
+		Tokenizer *tokenizerJSON
+	}{options: (*options)(o)}
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&decoded)
+	if err != nil || decoded.Tokenizer == nil {
+		return err
+	}
+	o.Tokenizer, err = decoded.Tokenizer.tokenizer()
+	return err
+}
@@ -0,0 +1,594 @@
+package rnn
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"path/filepath"
+	"testing"
+)
+
+var inputs = []string{
+	`{"name":"alice","age":31,"tags":["a","b"]}`,
+	`{"name":"bob","age":42,"tags":["c"]}`,
+	`{"name":"carol","age":27,"tags":[]}`,
+}
+
+var probe = `{"x":1}`
+
+// TestCosts checks that the costs of the LSTM and GRU cells don't change for a
+// fixed seed, and that the graph they learn with computes the same costs as
+// the model without a graph.
+//
+// The costs of the original lstm and gru packages aren't kept: their graphs
+// gave the one-hot inputs and targets of a step no names, so Gorgonia merged
+// the two nodes and each step learned to predict the byte it was given rather
+// than the next one. The LSTM graph also overwrote the cell state with its
+// tanh before feeding it back. The recorded costs are those of the corrected
+// graph, which is pinned to the pure Go costs below
+func TestCosts(t *testing.T) {
+	tests := []struct {
+		name      string
+		cell      Cell
+		surprises []float32
+		profile   []float32
+	}{
+		{
+			name:      "LSTM",
+			cell:      LSTM{},
+			surprises: []float32{5.3960443, 2.743646, 2.4723525},
+			profile:   []float32{1.0664377, 8.042992, 1.2743096, 1.1914146, 5.4138703, 5.0713754},
+		},
+		{
+			name:      "GRU",
+			cell:      GRU{},
+			surprises: []float32{5.4200644, 3.135154, 2.3186963},
+			profile:   []float32{0.6684305, 9.973917, 1.9165783, 2.8703609, 3.9972503, 4.5134077},
+		},
+	}
+	equal := func(a, b float32) bool {
+		return math.Abs(float64(a-b)) <= 1e-4*math.Abs(float64(b))
+	}
+	for _, test := range tests {
+		engine := NewEngine(rand.New(rand.NewSource(1)), test.cell, DefaultOptions())
+		for i, input := range inputs {
+			surprise, _ := engine.Train([]byte(input))
+			if !equal(surprise, test.surprises[i]) {
+				t.Errorf("%s: surprise %d is %v, expected %v", test.name, i, surprise, test.surprises[i])
+			}
+		}
+		profile := engine.Profile([]byte(probe))[1:]
+		for i, cost := range profile {
+			if !equal(cost, test.profile[i]) {
+				t.Errorf("%s: cost %d is %v, expected %v", test.name, i, cost, test.profile[i])
+			}
+		}
+
+		options := DefaultOptions()
+		engine = NewEngine(rand.New(rand.NewSource(1)), test.cell, options)
+		symbols, _ := engine.tokenizer.Encode([]byte(inputs[0]))
+		var expected float32
+		for _, cost := range engine.costs(symbols)[:options.Steps-1] {
+			expected += cost
+		}
+		data := make([]rune, len(symbols))
+		for i, v := range symbols {
+			data[i] = rune(v)
+		}
+		costs, _, err := engine.learner.Learn(data, 0, options.NewOptimizer())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cost := float32(costs[0]); !equal(cost, expected) {
+			t.Errorf("%s: graph cost is %v, expected %v", test.name, cost, expected)
+		}
+	}
+}
+
+// TestCells checks that every cell learns
+func TestCells(t *testing.T) {
+	for _, cell := range []Cell{LSTM{}, GRU{}, Elman{}, MGU{}, IndRNN{}} {
+		engine := NewEngine(rand.New(rand.NewSource(1)), cell, DefaultOptions())
+		var first, last float32
+		for i := 0; i < 10; i++ {
+			surprise, _ := engine.Train([]byte(inputs[i%len(inputs)]))
+			if math.IsNaN(float64(surprise)) || math.IsInf(float64(surprise), 0) {
+				t.Fatalf("%T: surprise is %v", cell, surprise)
+			}
+			if i == 0 {
+				first = surprise
+			}
+			last = surprise
+		}
+		if last >= first {
+			t.Errorf("%T: surprise didn't decrease from %v to %v", cell, first, last)
+		}
+	}
+}
+
+// TestInference checks that the costs computed without a graph are the same
+// as those computed with Gorgonia
+func TestInference(t *testing.T) {
+	for _, cell := range []Cell{LSTM{}, GRU{}, Elman{}, MGU{}, IndRNN{}} {
+		options := DefaultOptions()
+		options.HiddenSizes = []int{10, 8}
+		engine := NewEngine(rand.New(rand.NewSource(1)), cell, options)
+		for _, input := range inputs {
+			engine.Train([]byte(input))
+		}
+		inference := NewCharRNN(engine.Model, engine.learner.Vocabulary)
+		err := inference.ModeInference()
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, input := range append(inputs, probe) {
+			expected, costs := inference.graphCosts([]byte(input)), engine.Costs([]byte(input))
+			if len(costs) != len(expected) {
+				t.Fatalf("%T: %d costs, expected %d", cell, len(costs), len(expected))
+			}
+			for i, cost := range costs {
+				if math.Abs(float64(cost-expected[i])) > 1e-4*(1+math.Abs(float64(expected[i]))) {
+					t.Errorf("%T: cost %d is %v, expected %v", cell, i, cost, expected[i])
+				}
+			}
+		}
+	}
+}
+
+// TestEmbed checks the pooling of the states into embeddings
+func TestEmbed(t *testing.T) {
+	engine := NewEngine(rand.New(rand.NewSource(1)), LSTM{}, DefaultOptions())
+	for _, input := range inputs {
+		engine.Train([]byte(input))
+	}
+	last, mean := engine.Embed([]byte(probe), PoolingLast), engine.Embed([]byte(probe), PoolingMean)
+	if len(last) != engine.StateSize() || len(mean) != engine.StateSize() {
+		t.Fatalf("embedding sizes are %d and %d, expected %d", len(last), len(mean), engine.StateSize())
+	}
+	sum := make([]float32, engine.StateSize())
+	for i := range probe {
+		for j, v := range engine.Embed([]byte(probe[:i+1]), PoolingLast) {
+			sum[j] += v
+		}
+	}
+	for i, v := range sum {
+		if d := v/float32(len(probe)) - mean[i]; math.Abs(float64(d)) > 1e-5 {
+			t.Errorf("mean %d is %v, expected %v", i, mean[i], v/float32(len(probe)))
+		}
+	}
+	for i, v := range engine.Embed([]byte(probe[:1]), PoolingMean) {
+		if single := engine.Embed([]byte(probe[:1]), PoolingLast)[i]; v != single {
+			t.Errorf("mean of a single state %d is %v, expected %v", i, v, single)
+		}
+	}
+}
+
+// TestStateful checks that the states are carried across chunks by learning
+// without changing the weights
+func TestStateful(t *testing.T) {
+	for _, cell := range []Cell{LSTM{}, GRU{}} {
+		options := DefaultOptions()
+		options.Steps, options.Stateful, options.LearnRate, options.L2Reg = 8, true, 0, 0
+		engine := NewEngine(rand.New(rand.NewSource(1)), cell, options)
+		for _, input := range inputs {
+			data := []rune(input)
+			costs, _, err := engine.learner.LearnStateful(data, engine.optimizer)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if expected := (len(data) + options.Steps - 3) / (options.Steps - 1); len(costs) != expected {
+				t.Fatalf("%T: %d chunks, expected %d", cell, len(costs), expected)
+			}
+			sum := 0.0
+			for _, cost := range costs {
+				sum += cost
+			}
+			if expected := float64(engine.Cost([]byte(input))); math.Abs(sum-expected) > 1e-4*expected {
+				t.Errorf("%T: cost is %v, expected %v", cell, sum, expected)
+			}
+		}
+
+		options.LearnRate = DefaultOptions().LearnRate
+		engine = NewEngine(rand.New(rand.NewSource(1)), cell, options)
+		var first, last float32
+		for i := 0; i < 10; i++ {
+			surprise, _ := engine.Train([]byte(inputs[i%len(inputs)]))
+			if i == 0 {
+				first = surprise
+			}
+			last = surprise
+		}
+		if last >= first {
+			t.Errorf("%T: surprise didn't decrease from %v to %v", cell, first, last)
+		}
+	}
+}
+
+// TestValidate checks that engines aren't created with fewer than 2 steps or
+// without sizes
+func TestValidate(t *testing.T) {
+	for steps, expected := range map[int]error{-1: ErrSteps, 0: ErrSteps, 1: ErrSteps, 2: nil, 4: nil} {
+		options := DefaultOptions()
+		options.Steps, options.Stateful = steps, true
+		if err := options.Validate(); err != expected {
+			t.Errorf("error for %d steps is %v, expected %v", steps, err, expected)
+		}
+		func() {
+			defer func() {
+				if err := recover(); err != expected {
+					t.Errorf("panic for %d steps is %v, expected %v", steps, err, expected)
+				}
+			}()
+			engine := NewEngine(rand.New(rand.NewSource(1)), GRU{}, options)
+			engine.Train([]byte(inputs[0]))
+		}()
+		func() {
+			defer func() {
+				if err := recover(); err != expected {
+					t.Errorf("bidirectional panic for %d steps is %v, expected %v", steps, err, expected)
+				}
+			}()
+			b := NewBidirectional(rand.New(rand.NewSource(1)), GRU{}, options)
+			b.Train([]byte(inputs[0]))
+		}()
+	}
+
+	options := DefaultOptions()
+	for _, sizes := range [][]int{nil, {10, 0}} {
+		options.HiddenSizes = sizes
+		if err := options.Validate(); err != ErrSizes {
+			t.Errorf("error for hidden sizes %v is %v, expected %v", sizes, err, ErrSizes)
+		}
+	}
+	options.HiddenSizes, options.EmbeddingSize = []int{10}, 0
+	if err := options.Validate(); err != ErrSizes {
+		t.Errorf("error for embedding size 0 is %v, expected %v", err, ErrSizes)
+	}
+}
+
+// TestGenerate checks the controls of generation
+func TestGenerate(t *testing.T) {
+	engine := NewEngine(rand.New(rand.NewSource(1)), LSTM{}, DefaultOptions())
+	for _, input := range inputs {
+		engine.Train([]byte(input))
+	}
+	prompt := []rune(`{"name":`)
+	argmax := engine.Generate(rand.New(rand.NewSource(1)), Generation{
+		Prompt:    prompt,
+		MaxLength: 16,
+	})
+	if len(argmax) > 16 {
+		t.Fatalf("generated %d symbols, expected at most 16", len(argmax))
+	}
+	top := engine.Generate(rand.New(rand.NewSource(2)), Generation{
+		Prompt:      prompt,
+		Temperature: 1,
+		TopK:        1,
+		MaxLength:   16,
+	})
+	if string(top) != string(argmax) {
+		t.Errorf("top 1 generated %q, expected %q", top, argmax)
+	}
+
+	sampled := engine.Generate(rand.New(rand.NewSource(1)), Generation{
+		Temperature: 1,
+		MaxLength:   256,
+		Stop:        StopBalanced,
+	})
+	if len(sampled) > 256 {
+		t.Fatalf("generated %d symbols, expected at most 256", len(sampled))
+	}
+
+	for text, expected := range map[string]bool{
+		`{"a":[1,2]}`: true,
+		`{"a":[1,2]`:  false,
+		`{"a":"}"`:    false,
+		`{"a":"\"}"}`: true,
+		`abc`:         false,
+	} {
+		if StopBalanced([]rune(text)) != expected {
+			t.Errorf("StopBalanced(%q) is %v, expected %v", text, !expected, expected)
+		}
+	}
+}
+
+// TestCheckpoint checks that a model is restored from a checkpoint
+func TestCheckpoint(t *testing.T) {
+	for name, cell := range cells {
+		options := DefaultOptions()
+		options.HiddenSizes = []int{10, 8}
+		engine := NewEngine(rand.New(rand.NewSource(1)), cell, options)
+		for _, input := range inputs {
+			engine.Train([]byte(input))
+		}
+		file := filepath.Join(t.TempDir(), "checkpoint.json")
+		checkpoint := Checkpoint{
+			Iteration:  len(inputs),
+			Options:    options,
+			Vocabulary: engine.learner.Vocabulary,
+			Model:      engine.Model,
+		}
+		if err := checkpoint.Save(file); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadCheckpoint(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Iteration != len(inputs) || loaded.Options.Steps != options.Steps {
+			t.Errorf("%s: checkpoint is %d %+v", name, loaded.Iteration, loaded.Options)
+		}
+
+		expected, restored := engine.Costs([]byte(probe)), loaded.Model.Costs([]byte(probe))
+		for i := range expected {
+			if expected[i] != restored[i] {
+				t.Errorf("%s: cost %d is %v, expected %v", name, i, restored[i], expected[i])
+			}
+		}
+
+		data, err := json.Marshal(engine)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fresh := NewEngine(rand.New(rand.NewSource(2)), cell, options)
+		if err = json.Unmarshal(data, fresh); err != nil {
+			t.Fatal(err)
+		}
+		for i, cost := range fresh.Costs([]byte(probe)) {
+			if cost != expected[i] {
+				t.Errorf("%s: engine cost %d is %v, expected %v", name, i, cost, expected[i])
+			}
+		}
+		before := fresh.Cost([]byte(probe))
+		fresh.Train([]byte(probe))
+		if fresh.Cost([]byte(probe)) == before {
+			t.Errorf("%s: loaded engine didn't learn", name)
+		}
+
+		r := NewCharRNN(loaded.Model, loaded.Vocabulary)
+		cost := 0.0
+		for _, c := range expected {
+			cost += float64(c)
+		}
+		perplexity := r.Perplexity([][]rune{[]rune(probe)})
+		if e := math.Exp(cost / float64(len(expected))); math.Abs(perplexity-e) > 1e-4*e {
+			t.Errorf("%s: perplexity is %v, expected %v", name, perplexity, e)
+		}
+	}
+}
+
+// TestSolvers checks a step of the Adam and momentum solvers against steps
+// computed by hand, and that Adam clips the gradients
+func TestSolvers(t *testing.T) {
+	equal := func(a, b float32) bool {
+		return math.Abs(float64(a-b)) <= 1e-6
+	}
+
+	// the first Adam step is the learning rate in the direction of the
+	// gradient
+	adam := Optimizer{Solver: SolverAdam, LearnRate: 0.1, Iteration: 1}
+	w, g := []float32{1, -1}, []float32{0.5, -2}
+	adam.adam(w, g, make([]float32, 2), make([]float32, 2))
+	if !equal(w[0], 0.9) || !equal(w[1], -0.9) {
+		t.Errorf("weights after an Adam step are %v, expected [0.9 -0.9]", w)
+	}
+
+	// the gradients are clipped before Adam steps
+	adam = Optimizer{Solver: SolverAdam, LearnRate: 0.1, Clip: 1, Iteration: 1}
+	w, g = []float32{1, 1}, []float32{4, 0.5}
+	means, variances := make([]float32, 2), make([]float32, 2)
+	adam.adam(w, g, means, variances)
+	if !equal(means[0], 0.1) || !equal(variances[0], 0.001) {
+		t.Errorf("Adam averages are %v and %v, expected 0.1 and 0.001 from a clipped gradient", means[0], variances[0])
+	}
+
+	// the L2 regularization is of the weight, not of the velocity
+	momentum := Optimizer{Solver: SolverMomentum, LearnRate: 0.1, L2Reg: 0.1, Momentum: 0.9}
+	w, g, velocities := []float32{1}, []float32{0.5}, []float32{0.1}
+	momentum.momentum(w, g, velocities)
+	if !equal(velocities[0], 0.03) || !equal(w[0], 1.03) {
+		t.Errorf("velocity and weight after a momentum step are %v and %v, expected 0.03 and 1.03", velocities[0], w[0])
+	}
+}
+
+// TestResume checks that training resumed from a checkpoint learns the same
+// weights as training that wasn't interrupted
+func TestResume(t *testing.T) {
+	for _, solver := range []Solver{SolverRMSProp, SolverAdam, SolverMomentum} {
+		options := DefaultOptions()
+		options.Solver = solver
+		engine := NewEngine(rand.New(rand.NewSource(1)), LSTM{}, options)
+		for _, input := range inputs[:2] {
+			engine.Train([]byte(input))
+		}
+		file := filepath.Join(t.TempDir(), "checkpoint.json")
+		checkpoint := Checkpoint{
+			Iteration:  2,
+			Options:    options,
+			Vocabulary: engine.learner.Vocabulary,
+			Model:      engine.Model,
+			Optimizer:  engine.optimizer,
+		}
+		if err := checkpoint.Save(file); err != nil {
+			t.Fatal(err)
+		}
+		loaded, err := LoadCheckpoint(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		resumed := NewEngine(rand.New(rand.NewSource(2)), LSTM{}, loaded.Options)
+		if err = resumed.Model.assign(loaded.Model); err != nil {
+			t.Fatal(err)
+		}
+		resumed.optimizer = loaded.Optimizer
+
+		for _, input := range inputs[2:] {
+			engine.Train([]byte(input))
+			resumed.Train([]byte(input))
+		}
+		expected := engine.Costs([]byte(probe))
+		for i, cost := range resumed.Costs([]byte(probe)) {
+			if cost != expected[i] {
+				t.Errorf("solver %d: cost %d is %v, expected %v", solver, i, cost, expected[i])
+			}
+		}
+	}
+}
+
+// TestTokenizers checks that the tokenizers split and join documents
+func TestTokenizers(t *testing.T) {
+	corpus := [][]byte{[]byte(`{"name":"zoë","city":"münchen"}`), []byte(`{"name":"zoë","city":"köln"}`)}
+	for _, input := range inputs {
+		corpus = append(corpus, []byte(input))
+	}
+	runes := NewRuneTokenizer(corpus, 64)
+	bpe := NewBPETokenizer(corpus, 64, 16)
+	if len(bpe.Merges) == 0 {
+		t.Fatal("no merges were learned")
+	}
+
+	for _, tokenizer := range []Tokenizer{ByteTokenizer{}, runes, bpe} {
+		for _, document := range corpus {
+			symbols, ends := tokenizer.Encode(document)
+			if len(symbols) != len(ends) || ends[len(ends)-1] != len(document) {
+				t.Fatalf("%T: %d symbols and ends %v", tokenizer, len(symbols), ends)
+			}
+			for _, symbol := range symbols {
+				if symbol < 0 || symbol >= tokenizer.Size() {
+					t.Fatalf("%T: symbol %d is out of range", tokenizer, symbol)
+				}
+			}
+			if decoded := tokenizer.Decode(symbols); string(decoded) != string(document) {
+				t.Errorf("%T: decoded %q, expected %q", tokenizer, decoded, document)
+			}
+		}
+	}
+
+	symbols, _ := runes.Encode([]byte("zö"))
+	if len(symbols) != 2 || symbols[1] == runes.Unknown {
+		t.Errorf("runes of zö are %v", symbols)
+	}
+	symbols, ends := runes.Encode([]byte("z\xffж"))
+	if len(symbols) != 3 || symbols[1] != runes.Unknown || symbols[2] != runes.Unknown || ends[2] != 4 {
+		t.Errorf("runes of an invalid byte and an unknown rune are %v %v", symbols, ends)
+	}
+	if decoded := runes.Decode(symbols); string(decoded) != "z��" {
+		t.Errorf("decoded %q", decoded)
+	}
+	merged, _ := bpe.Encode(corpus[0])
+	if all, _ := runes.Encode(corpus[0]); len(merged) >= len(all) {
+		t.Errorf("%d symbols after merging, expected fewer than %d", len(merged), len(all))
+	}
+	if empty := NewRuneTokenizer(corpus, 0); empty.Size() != 1 {
+		t.Errorf("rune tokenizer of size 0 has %d symbols, expected 1", empty.Size())
+	}
+
+	for _, tokenizer := range []Tokenizer{ByteTokenizer{}, runes, bpe} {
+		options := DefaultOptions()
+		options.Tokenizer = tokenizer
+		data, err := json.Marshal(options)
+		if err != nil {
+			t.Fatal(err)
+		}
+		loaded := DefaultOptions()
+		if err = json.Unmarshal(data, &loaded); err != nil {
+			t.Fatal(err)
+		}
+		if loaded.Tokenizer == nil || loaded.Tokenizer.Size() != tokenizer.Size() {
+			t.Fatalf("%T: loaded tokenizer is %T", tokenizer, loaded.Tokenizer)
+		}
+		expected, _ := tokenizer.Encode(corpus[0])
+		symbols, _ := loaded.Tokenizer.Encode(corpus[0])
+		if fmt.Sprint(symbols) != fmt.Sprint(expected) {
+			t.Errorf("%T: loaded tokenizer encodes %v, expected %v", tokenizer, symbols, expected)
+		}
+	}
+
+	var vocabulary Vocabulary
+	if err := json.Unmarshal([]byte(`{"List":[2,97,3],"Index":{"2":0,"97":1,"3":2}}`), &vocabulary); err != nil {
+		t.Fatal(err)
+	}
+	if vocabulary.Unknown != 0 || vocabulary.Symbol('b') != 0 {
+		t.Errorf("vocabulary without UNKNOWN maps unknown runes to %d", vocabulary.Symbol('b'))
+	}
+	vocabulary = Vocabulary{}
+	if err := json.Unmarshal([]byte(`{"List":[2,26,97,3],"Index":{"2":0,"26":1,"97":2,"3":3}}`), &vocabulary); err != nil {
+		t.Fatal(err)
+	}
+	if vocabulary.Unknown != 1 {
+		t.Errorf("vocabulary with UNKNOWN maps unknown runes to %d, expected 1", vocabulary.Unknown)
+	}
+
+	options := DefaultOptions()
+	options.Tokenizer = bpe
+	engine := NewEngine(rand.New(rand.NewSource(1)), LSTM{}, options)
+	for _, document := range corpus {
+		engine.Train(document)
+	}
+	profile, sum := engine.Profile(corpus[0]), 0.0
+	for _, v := range profile {
+		sum += float64(v)
+	}
+	if len(profile) != len(corpus[0]) {
+		t.Errorf("profile has %d bytes, expected %d", len(profile), len(corpus[0]))
+	}
+	if cost := float64(engine.Cost(corpus[0])); math.Abs(sum-cost) > 1e-4*cost {
+		t.Errorf("profile sums to %v, expected %v", sum, cost)
+	}
+	if len(engine.Embed(corpus[0], PoolingMean)) != engine.StateSize() {
+		t.Error("embedding has the wrong size")
+	}
+	engine.Generate(rand.New(rand.NewSource(1)), Generation{Temperature: 1, MaxLength: 16, Stop: StopBalanced})
+}
+
+// TestBidirectional checks that the graph and the computation without a graph
+// of the bidirectional engine are the same for documents of one or more
+// windows, and that each symbol is predicted from the symbols on both sides of
+// it in its window
+func TestBidirectional(t *testing.T) {
+	for _, cell := range []Cell{LSTM{}, GRU{}} {
+		options := DefaultOptions()
+		options.Steps, options.HiddenSizes, options.LearnRate, options.L2Reg = 16, []int{10, 8}, 0, 0
+		b := NewBidirectional(rand.New(rand.NewSource(1)), cell, options)
+		for _, input := range []string{inputs[0][:16], inputs[0][:5], inputs[0]} {
+			symbols, _ := b.tokenizer.Encode([]byte(input))
+			cost, err := b.learn(symbols)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected := float32(0)
+			for _, c := range b.costs(symbols) {
+				expected += c
+			}
+			if math.Abs(float64(cost-expected)) > 1e-4*float64(expected) {
+				t.Errorf("%T: cost of %q is %v, expected %v", cell, input, cost, expected)
+			}
+		}
+
+		input := []byte(inputs[0])
+		profile := b.Profile(input)
+		if profile[0] == 0 {
+			t.Errorf("%T: the first byte has no surprise", cell)
+		}
+		changed := append([]byte(nil), input...)
+		changed[options.Steps-1] = 'x'
+		if after := b.Profile(changed); after[0] == profile[0] {
+			t.Errorf("%T: the surprise of the first byte doesn't depend on the last byte of its window", cell)
+		}
+		changed = append([]byte(nil), input...)
+		changed[options.Steps] = 'x'
+		if after := b.Profile(changed); after[0] != profile[0] {
+			t.Errorf("%T: the surprise of the first byte depends on the next window", cell)
+		}
+	}
+
+	b := NewBidirectional(rand.New(rand.NewSource(1)), LSTM{}, DefaultBidirectionalOptions())
+	before, _ := b.Score([]byte(inputs[0]))
+	for i := 0; i < 30; i++ {
+		b.Train([]byte(inputs[i%len(inputs)]))
+	}
+	if after, _ := b.Score([]byte(inputs[0])); after >= before {
+		t.Errorf("surprise didn't decrease from %v to %v", before, after)
+	}
+}
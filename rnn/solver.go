@@ -0,0 +1,189 @@
+package rnn
+
+import (
+	"fmt"
+	"math"
+
+	G "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+)
+
+// Optimizer updates weights from their gradients with the solver of the
+// options. Its running averages are exported so they can be saved in a
+// checkpoint
+type Optimizer struct {
+	Solver    Solver  `json:"solver"`
+	LearnRate float64 `json:"learn_rate"`
+	L2Reg     float64 `json:"l2_reg"`
+	Clip      float64 `json:"clip"`
+	Momentum  float64 `json:"momentum"`
+	// Iteration is the number of updates
+	Iteration int `json:"iteration"`
+	// Averages are the running averages of each weight: the mean square of
+	// the gradient for RMSProp, the mean gradient for Adam and the velocity
+	// for momentum
+	Averages [][]float32 `json:"averages"`
+	// Variances are the mean squares of the gradients of each weight for
+	// Adam
+	Variances [][]float32 `json:"variances,omitempty"`
+}
+
+const (
+	// rmsPropDecay is the decay of the mean square of the gradient
+	rmsPropDecay = 0.999
+	// adamBeta1 is the decay of the mean gradient
+	adamBeta1 = 0.9
+	// adamBeta2 is the decay of the mean square of the gradient
+	adamBeta2 = 0.999
+	// epsilon keeps the step size finite
+	epsilon = 1e-8
+)
+
+// NewOptimizer creates the optimizer described by the options
+func (o *Options) NewOptimizer() *Optimizer {
+	return &Optimizer{
+		Solver:    o.Solver,
+		LearnRate: o.LearnRate,
+		L2Reg:     o.L2Reg,
+		Clip:      o.Clip,
+		Momentum:  o.Momentum,
+	}
+}
+
+// reset creates an optimizer with the hyperparameters of o and no running
+// averages
+func (o *Optimizer) reset() *Optimizer {
+	return &Optimizer{
+		Solver:    o.Solver,
+		LearnRate: o.LearnRate,
+		L2Reg:     o.L2Reg,
+		Clip:      o.Clip,
+		Momentum:  o.Momentum,
+	}
+}
+
+// Check checks that the running averages of the optimizer are for the
+// weights of the nodes
+func (o *Optimizer) Check(nodes G.Nodes) error {
+	if o.Averages == nil {
+		return nil
+	}
+	if len(o.Averages) != len(nodes) {
+		return fmt.Errorf("optimizer has averages of %d weights, not %d", len(o.Averages), len(nodes))
+	}
+	if o.Solver == SolverAdam && len(o.Variances) != len(nodes) {
+		return fmt.Errorf("optimizer has variances of %d weights, not %d", len(o.Variances), len(nodes))
+	}
+	for i, node := range nodes {
+		size := len(node.Value().Data().([]float32))
+		if o.Averages[i] != nil && len(o.Averages[i]) != size {
+			return fmt.Errorf("optimizer has %d averages for weight %d, not %d", len(o.Averages[i]), i, size)
+		}
+		if o.Solver == SolverAdam && len(o.Variances[i]) != len(o.Averages[i]) {
+			return fmt.Errorf("optimizer has %d variances for weight %d, not %d", len(o.Variances[i]), i, size)
+		}
+	}
+	return nil
+}
+
+// Update updates the weights of the nodes from their gradients and zeros the
+// gradients. The nodes must be given in the same order each time
+func (o *Optimizer) Update(nodes G.Nodes) error {
+	if o.Averages == nil {
+		o.Averages = make([][]float32, len(nodes))
+		if o.Solver == SolverAdam {
+			o.Variances = make([][]float32, len(nodes))
+		}
+	}
+	if len(o.Averages) != len(nodes) {
+		return fmt.Errorf("optimizer has averages of %d weights, not %d", len(o.Averages), len(nodes))
+	}
+	o.Iteration++
+	for i, node := range nodes {
+		grad, err := node.Grad()
+		if err != nil {
+			return err
+		}
+		w := node.Value().(*tensor.Dense).Data().([]float32)
+		g := grad.(*tensor.Dense).Data().([]float32)
+		if o.Averages[i] == nil {
+			o.Averages[i] = make([]float32, len(w))
+			if o.Solver == SolverAdam {
+				o.Variances[i] = make([]float32, len(w))
+			}
+		}
+		if len(o.Averages[i]) != len(w) {
+			return fmt.Errorf("optimizer has %d averages for weight %d, not %d", len(o.Averages[i]), i, len(w))
+		}
+		switch o.Solver {
+		case SolverAdam:
+			o.adam(w, g, o.Averages[i], o.Variances[i])
+		case SolverMomentum:
+			o.momentum(w, g, o.Averages[i])
+		default:
+			o.rmsProp(w, g, o.Averages[i])
+		}
+		for j := range g {
+			g[j] = 0
+		}
+	}
+	return nil
+}
+
+// clip clips a gradient to the clip of the optimizer, a clip of 0 or less
+// doesn't clip
+func (o *Optimizer) clip(x float32) float32 {
+	clip := float32(o.Clip)
+	if clip <= 0 {
+		return x
+	}
+	if x > clip {
+		return clip
+	} else if x < -clip {
+		return -clip
+	}
+	return x
+}
+
+// rmsProp scales the step of each weight by the root mean square of its
+// gradient
+func (o *Optimizer) rmsProp(w, g, cache []float32) {
+	decay, eps := float32(rmsPropDecay), float32(epsilon)
+	eta, l2Reg := float32(-o.LearnRate), float32(o.L2Reg)
+	for j, x := range g {
+		cache[j] = cache[j]*decay + x*x*float32(1.0-rmsPropDecay)
+		x = o.clip(x)
+		update := 1 / float32(math.Sqrt(float64(cache[j]+eps))) * (x * eta)
+		update -= w[j] * l2Reg
+		w[j] += update
+	}
+}
+
+// adam steps each weight by its bias corrected mean gradient over the root of
+// its bias corrected mean square gradient
+// https://arxiv.org/abs/1412.6980
+func (o *Optimizer) adam(w, g, means, variances []float32) {
+	beta1, beta2 := float32(adamBeta1), float32(adamBeta2)
+	omBeta1, omBeta2 := float32(1)-beta1, float32(1)-beta2
+	eta, l2Reg, eps := float32(-o.LearnRate), float32(o.L2Reg), float32(epsilon)
+	correction1 := float32(1) / float32(1-math.Pow(adamBeta1, float64(o.Iteration)))
+	correction2 := float32(1) / float32(1-math.Pow(adamBeta2, float64(o.Iteration)))
+	for j, x := range g {
+		x = o.clip(x) + l2Reg*w[j]
+		means[j] = omBeta1*x + beta1*means[j]
+		variances[j] = omBeta2*(x*x) + beta2*variances[j]
+		mean := eta * (means[j] * correction1)
+		deviation := float32(math.Sqrt(float64(variances[j]*correction2))) + eps
+		w[j] += mean / deviation
+	}
+}
+
+// momentum steps each weight by its velocity, a running sum of its gradients
+func (o *Optimizer) momentum(w, g, velocities []float32) {
+	eta, l2Reg, momentum := float32(-o.LearnRate), float32(o.L2Reg), float32(o.Momentum)
+	for j, x := range g {
+		x = o.clip(x) + l2Reg*w[j]
+		velocities[j] = velocities[j]*momentum + x*eta
+		w[j] += velocities[j]
+	}
+}
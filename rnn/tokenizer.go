@@ -0,0 +1,308 @@
+package rnn
+
+import (
+	"fmt"
+	"sort"
+	"unicode/utf8"
+)
+
+// Tokenizer splits documents into the symbols of a model
+type Tokenizer interface {
+	// Size is the number of symbols
+	Size() int
+	// Encode splits the input into symbols, ends are the offsets of the byte
+	// after each symbol
+	Encode(input []byte) (symbols, ends []int)
+	// Decode joins symbols into bytes
+	Decode(symbols []int) []byte
+}
+
+// ByteTokenizer uses each byte as a symbol
+type ByteTokenizer struct{}
+
+// Size is the number of byte values
+func (ByteTokenizer) Size() int {
+	return 256
+}
+
+// Encode uses each byte of the input as a symbol
+func (ByteTokenizer) Encode(input []byte) (symbols, ends []int) {
+	symbols, ends = make([]int, len(input)), make([]int, len(input))
+	for i, v := range input {
+		symbols[i], ends[i] = int(v), i+1
+	}
+	return symbols, ends
+}
+
+// Decode converts the symbols into bytes
+func (ByteTokenizer) Decode(symbols []int) []byte {
+	output := make([]byte, len(symbols))
+	for i, symbol := range symbols {
+		output[i] = byte(symbol)
+	}
+	return output
+}
+
+// RuneTokenizer uses each UTF-8 encoded rune as a symbol. Runes that aren't
+// in the vocabulary and invalid bytes are the UNKNOWN symbol
+type RuneTokenizer struct {
+	*Vocabulary
+}
+
+// NewRuneTokenizer creates a rune tokenizer with a vocabulary of UNKNOWN and
+// the size-1 most frequent runes of the corpus, size is at least 1
+func NewRuneTokenizer(corpus [][]byte, size int) *RuneTokenizer {
+	if size < 1 {
+		size = 1
+	}
+	counts := make(map[rune]int)
+	for _, document := range corpus {
+		for len(document) > 0 {
+			r, width := utf8.DecodeRune(document)
+			if !(r == utf8.RuneError && width == 1) && r != UNKNOWN {
+				counts[r]++
+			}
+			document = document[width:]
+		}
+	}
+
+	runes := make([]rune, 0, len(counts))
+	for r := range counts {
+		runes = append(runes, r)
+	}
+	sort.Slice(runes, func(i, j int) bool {
+		if counts[runes[i]] == counts[runes[j]] {
+			return runes[i] < runes[j]
+		}
+		return counts[runes[i]] > counts[runes[j]]
+	})
+	if len(runes) > size-1 {
+		runes = runes[:size-1]
+	}
+	return newRuneTokenizer(append([]rune{UNKNOWN}, runes...))
+}
+
+// newRuneTokenizer creates a rune tokenizer from a list of runes
+func newRuneTokenizer(list []rune) *RuneTokenizer {
+	index := make(map[rune]int)
+	for i, v := range list {
+		index[v] = i
+	}
+	return &RuneTokenizer{
+		Vocabulary: &Vocabulary{
+			List:    list,
+			Index:   index,
+			Unknown: index[UNKNOWN],
+		},
+	}
+}
+
+// Size is the size of the vocabulary
+func (t *RuneTokenizer) Size() int {
+	return len(t.List)
+}
+
+// Encode splits the input into runes
+func (t *RuneTokenizer) Encode(input []byte) (symbols, ends []int) {
+	offset := 0
+	for offset < len(input) {
+		r, width := utf8.DecodeRune(input[offset:])
+		offset += width
+		symbol := t.Unknown
+		if !(r == utf8.RuneError && width == 1) {
+			symbol = t.Symbol(r)
+		}
+		symbols, ends = append(symbols, symbol), append(ends, offset)
+	}
+	return symbols, ends
+}
+
+// Decode encodes the runes of the symbols as UTF-8, UNKNOWN is the
+// replacement character
+func (t *RuneTokenizer) Decode(symbols []int) []byte {
+	var output []byte
+	for _, symbol := range symbols {
+		r := t.List[symbol]
+		if symbol == t.Unknown {
+			r = utf8.RuneError
+		}
+		output = append(output, string(r)...)
+	}
+	return output
+}
+
+// BPETokenizer is a byte-pair encoding of runes, pairs of symbols that are
+// frequent in a corpus are merged into subword symbols
+// https://en.wikipedia.org/wiki/Byte_pair_encoding
+type BPETokenizer struct {
+	Runes *RuneTokenizer
+	// Merges are the merged pairs of symbols in the order they were learned,
+	// merge i creates symbol Runes.Size()+i
+	Merges [][2]int
+	ranks  map[[2]int]int
+}
+
+// NewBPETokenizer learns up to merges merges from a corpus on top of a rune
+// tokenizer of the given size
+func NewBPETokenizer(corpus [][]byte, size, merges int) *BPETokenizer {
+	t := &BPETokenizer{
+		Runes: NewRuneTokenizer(corpus, size),
+		ranks: make(map[[2]int]int),
+	}
+	documents := make([][]int, len(corpus))
+	for i, document := range corpus {
+		documents[i], _ = t.Runes.Encode(document)
+	}
+
+	for len(t.Merges) < merges {
+		counts := make(map[[2]int]int)
+		for _, document := range documents {
+			for i := 1; i < len(document); i++ {
+				counts[[2]int{document[i-1], document[i]}]++
+			}
+		}
+		best, max := [2]int{}, 1
+		for pair, count := range counts {
+			if count > max || (count == max && max > 1 && less(pair, best)) {
+				best, max = pair, count
+			}
+		}
+		if max < 2 {
+			break
+		}
+
+		t.ranks[best] = len(t.Merges)
+		t.Merges = append(t.Merges, best)
+		symbol := t.Size() - 1
+		for i, document := range documents {
+			documents[i], _ = merge(document, nil, best, symbol)
+		}
+	}
+	return t
+}
+
+// less orders pairs of symbols
+func less(a, b [2]int) bool {
+	if a[0] == b[0] {
+		return a[1] < b[1]
+	}
+	return a[0] < b[0]
+}
+
+// merge replaces the pair in the symbols with the merged symbol
+func merge(symbols, ends []int, pair [2]int, symbol int) ([]int, []int) {
+	j := 0
+	for i := 0; i < len(symbols); i++ {
+		if i+1 < len(symbols) && symbols[i] == pair[0] && symbols[i+1] == pair[1] {
+			symbols[j] = symbol
+			if ends != nil {
+				ends[j] = ends[i+1]
+			}
+			i++
+		} else {
+			symbols[j] = symbols[i]
+			if ends != nil {
+				ends[j] = ends[i]
+			}
+		}
+		j++
+	}
+	if ends != nil {
+		ends = ends[:j]
+	}
+	return symbols[:j], ends
+}
+
+// Size is the number of runes and merged symbols
+func (t *BPETokenizer) Size() int {
+	return t.Runes.Size() + len(t.Merges)
+}
+
+// Encode splits the input into runes and applies the merges in the order
+// they were learned
+func (t *BPETokenizer) Encode(input []byte) (symbols, ends []int) {
+	if t.ranks == nil {
+		ranks := make(map[[2]int]int, len(t.Merges))
+		for i, pair := range t.Merges {
+			ranks[pair] = i
+		}
+		t.ranks = ranks
+	}
+
+	symbols, ends = t.Runes.Encode(input)
+	for {
+		rank := -1
+		for i := 1; i < len(symbols); i++ {
+			if r, ok := t.ranks[[2]int{symbols[i-1], symbols[i]}]; ok && (rank < 0 || r < rank) {
+				rank = r
+			}
+		}
+		if rank < 0 {
+			return symbols, ends
+		}
+		symbols, ends = merge(symbols, ends, t.Merges[rank], t.Runes.Size()+rank)
+	}
+}
+
+// Decode expands merged symbols into runes and encodes them as UTF-8
+func (t *BPETokenizer) Decode(symbols []int) []byte {
+	var expand func(symbol int, runes []int) []int
+	expand = func(symbol int, runes []int) []int {
+		if symbol < t.Runes.Size() {
+			return append(runes, symbol)
+		}
+		pair := t.Merges[symbol-t.Runes.Size()]
+		return expand(pair[1], expand(pair[0], runes))
+	}
+	var runes []int
+	for _, symbol := range symbols {
+		runes = expand(symbol, runes)
+	}
+	return t.Runes.Decode(runes)
+}
+
+// tokenizerJSON is the JSON form of a tokenizer
+type tokenizerJSON struct {
+	Type   string   `json:"type"`
+	Runes  []rune   `json:"runes,omitempty"`
+	Merges [][2]int `json:"merges,omitempty"`
+}
+
+// newTokenizerJSON converts a tokenizer into its JSON form, nil is the
+// default tokenizer
+func newTokenizerJSON(tokenizer Tokenizer) (*tokenizerJSON, error) {
+	switch t := tokenizer.(type) {
+	case nil:
+		return nil, nil
+	case ByteTokenizer:
+		return &tokenizerJSON{Type: "byte"}, nil
+	case *RuneTokenizer:
+		return &tokenizerJSON{Type: "rune", Runes: t.List}, nil
+	case *BPETokenizer:
+		return &tokenizerJSON{Type: "bpe", Runes: t.Runes.List, Merges: t.Merges}, nil
+	}
+	return nil, fmt.Errorf("tokenizer %T can't be saved", tokenizer)
+}
+
+// tokenizer converts the JSON form of a tokenizer into a tokenizer
+func (t *tokenizerJSON) tokenizer() (Tokenizer, error) {
+	switch t.Type {
+	case "byte":
+		return ByteTokenizer{}, nil
+	case "rune":
+		return newRuneTokenizer(t.Runes), nil
+	case "bpe":
+		bpe := &BPETokenizer{
+			Runes:  newRuneTokenizer(t.Runes),
+			Merges: t.Merges,
+		}
+		for i, pair := range t.Merges {
+			size := len(t.Runes) + i
+			if pair[0] < 0 || pair[0] >= size || pair[1] < 0 || pair[1] >= size {
+				return nil, fmt.Errorf("merge %d of %v isn't of %d symbols", i, pair, size)
+			}
+		}
+		return bpe, nil
+	}
+	return nil, fmt.Errorf("unknown tokenizer %q", t.Type)
+}
@@ -0,0 +1,98 @@
+package rnn
+
+import "encoding/json"
+
+const (
+	// START is the start symbol
+	START rune = 0x02
+	// END is the end symbol
+	END rune = 0x03
+	// UNKNOWN is the symbol of runes that aren't in a vocabulary
+	UNKNOWN rune = 0x1A
+)
+
+// Vocabulary maps between runes and ints
+type Vocabulary struct {
+	List  []rune
+	Index map[rune]int
+	// Unknown is the index of runes that aren't in the vocabulary
+	Unknown int
+}
+
+// Symbol returns the index of a rune
+func (v *Vocabulary) Symbol(r rune) int {
+	if i, ok := v.Index[r]; ok {
+		return i
+	}
+	return v.Unknown
+}
+
+// UnmarshalJSON decodes a vocabulary from JSON. Vocabularies saved before
+// Unknown was added map unknown runes to UNKNOWN if they have it and to START,
+// the symbol they were learned as, otherwise
+func (v *Vocabulary) UnmarshalJSON(data []byte) error {
+	type vocabulary Vocabulary
+	decoded := struct {
+		*vocabulary
+		Unknown *int
+	}{vocabulary: (*vocabulary)(v)}
+	err := json.Unmarshal(data, &decoded)
+	if err != nil {
+		return err
+	}
+	if decoded.Unknown != nil {
+		v.Unknown = *decoded.Unknown
+	} else if i, ok := v.Index[UNKNOWN]; ok {
+		v.Unknown = i
+	} else {
+		v.Unknown = v.Index[START]
+	}
+	return nil
+}
+
+// NewVocabulary create a new vocabulary list
+func NewVocabulary(ss [][]rune, thresh int) *Vocabulary {
+	dict := make(map[rune]int)
+	for _, s := range ss {
+		for _, r := range s {
+			dict[r]++
+		}
+	}
+
+	list, index := []rune{START, UNKNOWN}, make(map[rune]int)
+
+	for ch, c := range dict {
+		if c >= thresh && ch != START && ch != END && ch != UNKNOWN {
+			// then add letter to vocab
+			list = append(list, ch)
+		}
+	}
+
+	list = append(list, END)
+
+	for i, v := range list {
+		index[v] = i
+	}
+
+	return &Vocabulary{
+		List:    list,
+		Index:   index,
+		Unknown: index[UNKNOWN],
+	}
+}
+
+// NewVocabularyFromRange create a new vocabulary list using a range
+func NewVocabularyFromRange(start, stop rune) *Vocabulary {
+	list, index := make([]rune, 0), make(map[rune]int)
+	for i := start; i < stop; i++ {
+		list = append(list, i)
+	}
+	for i, v := range list {
+		index[v] = i
+	}
+
+	return &Vocabulary{
+		List:  list,
+		Index: index,
+	}
+}
@@ -0,0 +1,246 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"sort"
+)
+
+const (
+	// schemaWarmup is the number of documents before changes are reported
+	schemaWarmup = 16
+	// schemaRare is the rate below which a type is a change
+	schemaRare = .01
+	// schemaRequired is the presence rate above which a path is required
+	schemaRequired = .99
+	// schemaDecay is the decay of the moving average rates
+	schemaDecay = .9
+	// schemaTrend is the difference between the recent and overall rates of a trend
+	schemaTrend = .5
+)
+
+// SchemaField is the inferred schema of a JSON path
+type SchemaField struct {
+	Parent  string
+	Present uint64
+	Types   map[string]uint64
+
+	// moving averages of the presence and type rates
+	RecentPresence float64
+	RecentTypes    map[string]float64
+
+	// array cardinality
+	Arrays               uint64
+	MinLength, MaxLength int
+	SumLength            uint64
+}
+
+// Optionality computes the rate a path is present when its parent is present
+func (s *SchemaField) Optionality(parent *SchemaField) float64 {
+	return float64(s.Present) / float64(parent.Present)
+}
+
+// SchemaResult is the result of schema drift detection for a document
+type SchemaResult struct {
+	Surprise float32
+	Changes  []Finding
+	Trends   []Finding
+}
+
+// Schema infers the schema of a stream of JSON documents and detects
+// documents that change it
+type Schema struct {
+	Fields map[string]*SchemaField
+}
+
+// NewSchema creates a new schema drift detector
+func NewSchema(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+	return &Schema{
+		Fields: map[string]*SchemaField{
+			"$": {
+				Types:       make(map[string]uint64),
+				RecentTypes: make(map[string]float64),
+			},
+		},
+	}
+}
+
+func schemaType(value interface{}) string {
+	switch value.(type) {
+	case map[string]interface{}:
+		return "object"
+	case []interface{}:
+		return "array"
+	}
+	return typeName(value)
+}
+
+// Detect computes the schema changes of a document and then learns its schema
+func (s *Schema) Detect(input []byte) *SchemaResult {
+	var object map[string]interface{}
+	err := json.Unmarshal(input, &object)
+	if err != nil {
+		panic(err)
+	}
+
+	root := s.Fields["$"]
+	result, present, warm := &SchemaResult{}, make(map[string]bool), root.Present >= schemaWarmup
+	types := make(map[string]map[string]bool)
+	change := func(path string, surprise float64, format string, a ...interface{}) {
+		if !warm {
+			return
+		}
+		result.Changes = append(result.Changes, Finding{
+			Path:     path,
+			Message:  fmt.Sprintf(format, a...),
+			Surprise: float32(surprise),
+		})
+	}
+
+	var process func(value interface{}, path, parent string)
+	process = func(value interface{}, path, parent string) {
+		field := s.Fields[path]
+		if field == nil {
+			field = &SchemaField{
+				Parent:      parent,
+				Types:       make(map[string]uint64),
+				RecentTypes: make(map[string]float64),
+			}
+			s.Fields[path] = field
+			change(path, math.Log2(float64(s.Fields[parent].Present+1)), "new path")
+		}
+		if !present[path] {
+			present[path] = true
+			types[path] = make(map[string]bool)
+			field.Present++
+		}
+
+		name, observed := schemaType(value), uint64(0)
+		for _, count := range field.Types {
+			observed += count
+		}
+		if count := field.Types[name]; observed > 0 && float64(count) < schemaRare*float64(observed) {
+			surprise := -math.Log2(float64(count+1) / float64(observed+2))
+			if count == 0 {
+				change(path, surprise, "type changed to %s", name)
+			} else {
+				change(path, surprise, "type %s seen in %.1f%% of values", name, 100*float64(count)/float64(observed))
+			}
+		}
+		field.Types[name]++
+		types[path][name] = true
+
+		switch value := value.(type) {
+		case map[string]interface{}:
+			for key, v := range value {
+				process(v, path+"."+key, path)
+			}
+		case []interface{}:
+			length := len(value)
+			if field.Arrays > 0 && (length < field.MinLength || length > field.MaxLength) {
+				change(path, math.Log2(float64(field.Arrays+1)),
+					"array length %d outside of observed range [%d, %d]", length, field.MinLength, field.MaxLength)
+			}
+			if field.Arrays == 0 || length < field.MinLength {
+				field.MinLength = length
+			}
+			if field.Arrays == 0 || length > field.MaxLength {
+				field.MaxLength = length
+			}
+			field.Arrays++
+			field.SumLength += uint64(length)
+			for _, v := range value {
+				process(v, path+"[]", path)
+			}
+		}
+	}
+	process(object, "$", "")
+
+	if warm {
+		for path, field := range s.Fields {
+			if present[path] || path == "$" || !present[field.Parent] {
+				continue
+			}
+			// the parent has already been counted for this document
+			previous := s.Fields[field.Parent].Present - 1
+			if rate := float64(field.Present) / float64(previous); rate >= schemaRequired {
+				change(path, -math.Log2(1-float64(field.Present)/float64(previous+1)),
+					"missing, present in %.1f%% of parents", 100*rate)
+			}
+		}
+	}
+
+	for path, field := range s.Fields {
+		if path != "$" && !present[field.Parent] {
+			continue
+		}
+		field.RecentPresence *= schemaDecay
+		if present[path] {
+			field.RecentPresence += 1 - schemaDecay
+		}
+		overall := 1.0
+		if path != "$" {
+			overall = field.Optionality(s.Fields[field.Parent])
+		}
+		if difference := math.Abs(field.RecentPresence - overall); warm && difference >= schemaTrend {
+			result.Trends = append(result.Trends, Finding{
+				Path: path,
+				Message: fmt.Sprintf("present in %.1f%% of recent parents, %.1f%% overall",
+					100*field.RecentPresence, 100*overall),
+				Surprise: float32(difference),
+			})
+		}
+		if !present[path] {
+			continue
+		}
+
+		observed := uint64(0)
+		for _, count := range field.Types {
+			observed += count
+		}
+		for name, count := range field.Types {
+			overall := float64(count) / float64(observed)
+			recent, found := field.RecentTypes[name]
+			if !found {
+				// a new type starts at its overall rate, otherwise the first
+				// type of a new path would be a falling trend
+				recent = overall
+			}
+			recent *= schemaDecay
+			if types[path][name] {
+				recent += 1 - schemaDecay
+			}
+			field.RecentTypes[name] = recent
+			if difference := math.Abs(recent - overall); warm && difference >= schemaTrend {
+				result.Trends = append(result.Trends, Finding{
+					Path: path,
+					Message: fmt.Sprintf("type %s in %.1f%% of recent documents, %.1f%% of values overall",
+						name, 100*recent, 100*overall),
+					Surprise: float32(difference),
+				})
+			}
+		}
+	}
+
+	sort.Slice(result.Changes, func(i, j int) bool {
+		return result.Changes[i].Surprise > result.Changes[j].Surprise
+	})
+	sort.Slice(result.Trends, func(i, j int) bool {
+		return result.Trends[i].Surprise > result.Trends[j].Surprise
+	})
+	for _, finding := range result.Changes {
+		result.Surprise += finding.Surprise
+	}
+	return result
+}
+
+// Train computes the surprise with schema drift detection
+func (s *Schema) Train(input []byte) (surprise, uncertainty float32) {
+	return s.Detect(input).Surprise, 0
+}
@@ -0,0 +1,166 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"math"
+	"reflect"
+	"testing"
+)
+
+// TestSchemaChanges checks the schema changes of a document after learning
+// the schema of other documents
+func TestSchemaChanges(t *testing.T) {
+	base := `{"a":1,"b":[1,2],"c":{"d":"x"}}`
+	tests := []struct {
+		name      string
+		documents []string
+		document  string
+		changes   []Finding
+	}{
+		{
+			name:      "normal",
+			documents: repeat(base, schemaWarmup),
+			document:  base,
+		},
+		{
+			name:      "warmup",
+			documents: repeat(base, schemaWarmup-1),
+			document:  `{"a":"x"}`,
+		},
+		{
+			name:      "new path",
+			documents: repeat(base, schemaWarmup),
+			document:  `{"a":1,"b":[1,2],"c":{"d":"x"},"e":true}`,
+			changes:   []Finding{{"$.e", "new path", float32(math.Log2(18))}},
+		},
+		{
+			name:      "type changed",
+			documents: repeat(base, schemaWarmup),
+			document:  `{"a":"x","b":[1,2],"c":{"d":"x"}}`,
+			changes:   []Finding{{"$.a", "type changed to string", float32(math.Log2(18))}},
+		},
+		{
+			name:      "element type changed",
+			documents: repeat(base, schemaWarmup),
+			document:  `{"a":1,"b":[1,"x"],"c":{"d":"x"}}`,
+			// the first element has been counted before the second
+			changes: []Finding{{"$.b[]", "type changed to string", float32(math.Log2(35))}},
+		},
+		{
+			name:      "array length",
+			documents: repeat(base, schemaWarmup),
+			document:  `{"a":1,"b":[1,2,3],"c":{"d":"x"}}`,
+			changes:   []Finding{{"$.b", "array length 3 outside of observed range [2, 2]", float32(math.Log2(17))}},
+		},
+		{
+			name:      "missing",
+			documents: repeat(base, schemaWarmup),
+			document:  `{"b":[1,2],"c":{"d":"x"}}`,
+			changes:   []Finding{{"$.a", "missing, present in 100.0% of parents", float32(math.Log2(17))}},
+		},
+		{
+			name:      "missing in a nested object",
+			documents: repeat(base, schemaWarmup),
+			document:  `{"a":1,"b":[1,2],"c":{}}`,
+			changes:   []Finding{{"$.c.d", "missing, present in 100.0% of parents", float32(math.Log2(17))}},
+		},
+		{
+			// the children of a missing object aren't missing
+			name:      "missing object",
+			documents: repeat(base, schemaWarmup),
+			document:  `{"a":1,"b":[1,2]}`,
+			changes:   []Finding{{"$.c", "missing, present in 100.0% of parents", float32(math.Log2(17))}},
+		},
+		{
+			name:      "optional",
+			documents: append(repeat(base, schemaWarmup), `{"a":1,"b":[1,2]}`),
+			document:  `{"a":1,"b":[1,2]}`,
+		},
+	}
+	for _, test := range tests {
+		schema := NewSchema(nil, nil).(*Schema)
+		for _, document := range test.documents {
+			schema.Detect([]byte(document))
+		}
+		result := schema.Detect([]byte(test.document))
+		if len(result.Changes) != len(test.changes) {
+			t.Errorf("%s: changes are %v, expected %v", test.name, result.Changes, test.changes)
+			continue
+		}
+		sum := float32(0)
+		for i, change := range result.Changes {
+			expected := test.changes[i]
+			if change.Path != expected.Path || change.Message != expected.Message ||
+				math.Abs(float64(change.Surprise-expected.Surprise)) > 1e-4 {
+				t.Errorf("%s: change is %v %v, expected %v %v", test.name,
+					change, change.Surprise, expected, expected.Surprise)
+			}
+			sum += change.Surprise
+		}
+		if result.Surprise != sum {
+			t.Errorf("%s: surprise is %v, expected %v", test.name, result.Surprise, sum)
+		}
+		if len(result.Trends) != 0 {
+			t.Errorf("%s: trends are %v, expected none", test.name, result.Trends)
+		}
+	}
+}
+
+// TestSchemaTrends checks that rising and falling rates of a path and of its
+// types are trends
+func TestSchemaTrends(t *testing.T) {
+	tests := []struct {
+		name     string
+		before   string
+		after    string
+		count    int
+		trends   []string
+		messages []string
+	}{
+		{
+			name:   "number to string",
+			before: `{"a":1}`,
+			after:  `{"a":"x"}`,
+			count:  13,
+			trends: []string{"$.a", "$.a"},
+			messages: []string{
+				"type string in 75.2% of recent documents, 24.5% of values overall",
+				"type number in 25.4% of recent documents, 75.5% of values overall",
+			},
+		},
+		{
+			name:     "number to missing",
+			before:   `{"a":1,"b":2}`,
+			after:    `{"b":2}`,
+			count:    13,
+			trends:   []string{"$.a"},
+			messages: []string{"present in 25.0% of recent parents, 75.5% overall"},
+		},
+		{
+			name:   "too soon",
+			before: `{"a":1}`,
+			after:  `{"a":"x"}`,
+			count:  12,
+		},
+	}
+	for _, test := range tests {
+		schema := NewSchema(nil, nil).(*Schema)
+		for _, document := range repeat(test.before, 40) {
+			schema.Detect([]byte(document))
+		}
+		var result *SchemaResult
+		for _, document := range repeat(test.after, test.count) {
+			result = schema.Detect([]byte(document))
+		}
+		var trends, messages []string
+		for _, trend := range result.Trends {
+			trends, messages = append(trends, trend.Path), append(messages, trend.Message)
+		}
+		if !reflect.DeepEqual(trends, test.trends) || !reflect.DeepEqual(messages, test.messages) {
+			t.Errorf("%s: trends are %v, expected %v %v", test.name, result.Trends, test.trends, test.messages)
+		}
+	}
+}
@@ -0,0 +1,57 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import "math"
+
+// CountMinSketch estimates the frequency of hashed items in bounded memory
+// https://en.wikipedia.org/wiki/Count%E2%80%93min_sketch
+type CountMinSketch struct {
+	Width, Depth int
+	Counts       [][]uint32
+	Total        uint64
+}
+
+// NewCountMinSketch creates a new count-min sketch
+func NewCountMinSketch(width, depth int) *CountMinSketch {
+	counts := make([][]uint32, depth)
+	for i := range counts {
+		counts[i] = make([]uint32, width)
+	}
+	return &CountMinSketch{
+		Width:  width,
+		Depth:  depth,
+		Counts: counts,
+	}
+}
+
+// index computes the column of a hash for a row
+// https://www.eecs.harvard.edu/~michaelm/postscripts/rsa2008.pdf
+func (c *CountMinSketch) index(h uint64, row int) int {
+	a, b := uint32(h), uint32(h>>32)
+	return int((a + uint32(row)*b) % uint32(c.Width))
+}
+
+// Add adds a hashed item to the sketch
+func (c *CountMinSketch) Add(h uint64) {
+	for i, counts := range c.Counts {
+		j := c.index(h, i)
+		if counts[j] < math.MaxUint32 {
+			counts[j]++
+		}
+	}
+	c.Total++
+}
+
+// Count estimates the number of times a hashed item has been added
+func (c *CountMinSketch) Count(h uint64) uint32 {
+	count := uint32(math.MaxUint32)
+	for i, counts := range c.Counts {
+		if x := counts[c.index(h, i)]; x < count {
+			count = x
+		}
+	}
+	return count
+}
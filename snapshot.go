@@ -0,0 +1,530 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/pointlander/anomaly/rnn"
+)
+
+// ErrNotPersistent is returned for networks that can't be saved and loaded
+var ErrNotPersistent = errors.New("network can't be saved and loaded")
+
+// Persistent is a network whose learned state can be saved and loaded as JSON
+type Persistent interface {
+	Network
+	json.Marshaler
+	json.Unmarshaler
+}
+
+// check checks that a model decoded from JSON has the sizes of a CDF16 and
+// counts its nodes
+func (c *CDF16) check() error {
+	if c.Root == nil || len(c.Context) != CDF16Depth || len(c.Mixin) != CDF16Size ||
+		c.First < 0 || c.First >= CDF16Depth {
+		return errors.New("invalid cdf16 model")
+	}
+	var check func(n *Node16) error
+	check = func(n *Node16) error {
+		if len(n.Model) != CDF16Size+1 {
+			return fmt.Errorf("cdf16 node has %d entries", len(n.Model))
+		}
+		c.nodes++
+		if n.Children == nil {
+			n.Children = make(map[uint16]*Node16)
+		}
+		for _, child := range n.Children {
+			if child == nil {
+				return errors.New("cdf16 node has a nil child")
+			}
+			if err := check(child); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+	c.nodes = 0
+	return check(c.Root)
+}
+
+// MarshalJSON encodes the model of the Complexity as JSON
+func (c *Complexity) MarshalJSON() ([]byte, error) {
+	return json.Marshal(c.CDF16)
+}
+
+// UnmarshalJSON decodes the model of the Complexity from JSON
+func (c *Complexity) UnmarshalJSON(data []byte) error {
+	var model CDF16
+	err := json.Unmarshal(data, &model)
+	if err != nil {
+		return err
+	}
+	if err = model.check(); err != nil {
+		return err
+	}
+	c.CDF16 = &model
+	return nil
+}
+
+// MarshalJSON encodes the models of the meta engine as JSON
+func (m *Meta) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Models)
+}
+
+// UnmarshalJSON decodes the models of the meta engine from JSON
+func (m *Meta) UnmarshalJSON(data []byte) error {
+	var models []*CDF16
+	err := json.Unmarshal(data, &models)
+	if err != nil {
+		return err
+	}
+	for _, model := range models {
+		if model == nil {
+			return errors.New("meta engine has a nil model")
+		}
+		if err = model.check(); err != nil {
+			return err
+		}
+	}
+	m.Models = models
+	return nil
+}
+
+// averageSimilarityJSON is the JSON form of an average similarity engine
+type averageSimilarityJSON struct {
+	Vectors   [][]float32 `json:"vectors"`
+	Documents [][]byte    `json:"documents,omitempty"`
+}
+
+// MarshalJSON encodes the vectors and exemplars of the average similarity
+// engine as JSON, oldest first
+func (a *AverageSimilarity) MarshalJSON() ([]byte, error) {
+	var snapshot averageSimilarityJSON
+	c := a.begin
+	for i := 0; i < a.length; i++ {
+		snapshot.Vectors = append(snapshot.Vectors, a.vectors[c])
+		if a.documents != nil {
+			snapshot.Documents = append(snapshot.Documents, a.documents[c])
+		}
+		c = (c + 1) % vectorsSize
+	}
+	return json.Marshal(snapshot)
+}
+
+// UnmarshalJSON decodes the vectors and exemplars of the average similarity
+// engine from JSON
+func (a *AverageSimilarity) UnmarshalJSON(data []byte) error {
+	var snapshot averageSimilarityJSON
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return err
+	}
+	if len(snapshot.Vectors) > vectorsSize {
+		return fmt.Errorf("%d vectors, more than %d", len(snapshot.Vectors), vectorsSize)
+	}
+	for _, vector := range snapshot.Vectors {
+		if len(vector) != a.Vectorizer.Size {
+			return fmt.Errorf("vector has size %d, not %d", len(vector), a.Vectorizer.Size)
+		}
+	}
+	a.begin, a.length = 0, len(snapshot.Vectors)
+	copy(a.vectors, snapshot.Vectors)
+	if a.documents != nil {
+		copy(a.documents, snapshot.Documents)
+	}
+	return nil
+}
+
+// neuronJSON is the JSON form of a bank of neurons
+type neuronJSON struct {
+	Weights [][]float32 `json:"weights"`
+	Active  int         `json:"active"`
+}
+
+// MarshalJSON encodes the weights of the neurons as JSON
+func (n *Neuron) MarshalJSON() ([]byte, error) {
+	return json.Marshal(neuronJSON{
+		Weights: n.Weights,
+		Active:  n.active,
+	})
+}
+
+// UnmarshalJSON decodes the weights of the neurons from JSON, there must be
+// as many neurons as prototypes
+func (n *Neuron) UnmarshalJSON(data []byte) error {
+	var snapshot neuronJSON
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return err
+	}
+	if len(snapshot.Weights) != len(n.Weights) {
+		return fmt.Errorf("%d neurons, not %d", len(snapshot.Weights), len(n.Weights))
+	}
+	if snapshot.Active < 0 || snapshot.Active > len(n.Weights) {
+		return fmt.Errorf("%d active neurons of %d", snapshot.Active, len(n.Weights))
+	}
+	for _, weights := range snapshot.Weights {
+		if len(weights) != n.Vectorizer.Size {
+			return fmt.Errorf("neuron has %d weights, not %d", len(weights), n.Vectorizer.Size)
+		}
+	}
+	n.Weights, n.active = snapshot.Weights, snapshot.Active
+	return nil
+}
+
+// lofJSON is the JSON form of a local outlier factor engine
+type lofJSON struct {
+	Vectors [][]float32 `json:"vectors"`
+	Seen    int         `json:"seen"`
+}
+
+// MarshalJSON encodes the reservoir of the local outlier factor engine as
+// JSON, the distances are computed again when it is loaded
+func (l *LOF) MarshalJSON() ([]byte, error) {
+	return json.Marshal(lofJSON{
+		Vectors: l.vectors,
+		Seen:    l.seen,
+	})
+}
+
+// UnmarshalJSON decodes the reservoir of the local outlier factor engine from
+// JSON
+func (l *LOF) UnmarshalJSON(data []byte) error {
+	var snapshot lofJSON
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return err
+	}
+	if len(snapshot.Vectors) > lofReservoirSize {
+		return fmt.Errorf("%d vectors, more than %d", len(snapshot.Vectors), lofReservoirSize)
+	}
+	if snapshot.Seen < len(snapshot.Vectors) {
+		return fmt.Errorf("%d vectors seen, fewer than %d", snapshot.Seen, len(snapshot.Vectors))
+	}
+	for _, vector := range snapshot.Vectors {
+		if len(vector) != l.Vectorizer.Size {
+			return fmt.Errorf("vector has size %d, not %d", len(vector), l.Vectorizer.Size)
+		}
+	}
+	l.vectors = make([][]float32, 0, lofReservoirSize)
+	l.distances = make([][]float32, 0, lofReservoirSize)
+	for _, vector := range snapshot.Vectors {
+		distances := l.distancesTo(vector)
+		for i, d := range distances {
+			l.distances[i] = append(l.distances[i], d)
+		}
+		l.vectors = append(l.vectors, vector)
+		l.distances = append(l.distances, append(distances, 0))
+	}
+	l.seen = snapshot.Seen
+	return nil
+}
+
+// MarshalJSON encodes the fields of the schema as JSON
+func (s *Schema) MarshalJSON() ([]byte, error) {
+	return json.Marshal(s.Fields)
+}
+
+// UnmarshalJSON decodes the fields of the schema from JSON, the root field
+// "$" must be present
+func (s *Schema) UnmarshalJSON(data []byte) error {
+	var fields map[string]*SchemaField
+	err := json.Unmarshal(data, &fields)
+	if err != nil {
+		return err
+	}
+	if fields["$"] == nil {
+		return errors.New("schema has no root field")
+	}
+	for path, field := range fields {
+		if field == nil {
+			return fmt.Errorf("schema field %q is nil", path)
+		}
+		if field.Types == nil {
+			field.Types = make(map[string]uint64)
+		}
+		if field.RecentTypes == nil {
+			field.RecentTypes = make(map[string]float64)
+		}
+	}
+	s.Fields = fields
+	return nil
+}
+
+// check checks that a sketch decoded from JSON has the given sizes
+func (c *CountMinSketch) check(width, depth int) error {
+	if c == nil {
+		return errors.New("sketch is missing")
+	}
+	if c.Width != width || c.Depth != depth || len(c.Counts) != depth {
+		return fmt.Errorf("sketch is %dx%d, not %dx%d", c.Width, c.Depth, width, depth)
+	}
+	for _, counts := range c.Counts {
+		if len(counts) != width {
+			return fmt.Errorf("sketch row has width %d, not %d", len(counts), width)
+		}
+	}
+	return nil
+}
+
+// fieldStatisticsJSON is the JSON form of a field statistics engine
+type fieldStatisticsJSON struct {
+	Fields    map[string]*FieldStatistic `json:"fields"`
+	Values    *CountMinSketch            `json:"values"`
+	Documents uint64                     `json:"documents"`
+}
+
+// MarshalJSON encodes the statistics of the fields and the sketch of their
+// values as JSON
+func (f *FieldStatistics) MarshalJSON() ([]byte, error) {
+	return json.Marshal(fieldStatisticsJSON{
+		Fields:    f.Fields,
+		Values:    f.Values,
+		Documents: f.Documents,
+	})
+}
+
+// UnmarshalJSON decodes the statistics of the fields and the sketch of their
+// values from JSON
+func (f *FieldStatistics) UnmarshalJSON(data []byte) error {
+	var snapshot fieldStatisticsJSON
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return err
+	}
+	if err = snapshot.Values.check(fieldSketchWidth, fieldSketchDepth); err != nil {
+		return err
+	}
+	if snapshot.Fields == nil {
+		snapshot.Fields = make(map[string]*FieldStatistic)
+	}
+	for path, field := range snapshot.Fields {
+		if field == nil {
+			return fmt.Errorf("field %q is nil", path)
+		}
+		if len(field.Sample) > fieldSampleSize {
+			return fmt.Errorf("field %q has %d samples, more than %d", path, len(field.Sample), fieldSampleSize)
+		}
+		if field.Types == nil {
+			field.Types = make(map[string]uint64)
+		}
+	}
+	f.Fields, f.Values, f.Documents = snapshot.Fields, snapshot.Values, snapshot.Documents
+	return nil
+}
+
+// noveltyJSON is the JSON form of a novelty engine
+type noveltyJSON struct {
+	Words     *CountMinSketch `json:"words"`
+	Documents uint64          `json:"documents"`
+}
+
+// MarshalJSON encodes the sketch of the words seen by the novelty engine as
+// JSON
+func (n *Novelty) MarshalJSON() ([]byte, error) {
+	return json.Marshal(noveltyJSON{
+		Words:     n.CountMinSketch,
+		Documents: n.Documents,
+	})
+}
+
+// UnmarshalJSON decodes the sketch of the words seen by the novelty engine
+// from JSON
+func (n *Novelty) UnmarshalJSON(data []byte) error {
+	var snapshot noveltyJSON
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return err
+	}
+	if err = snapshot.Words.check(noveltyWidth, noveltyDepth); err != nil {
+		return err
+	}
+	n.CountMinSketch, n.Documents = snapshot.Words, snapshot.Documents
+	return nil
+}
+
+// coOccurrenceJSON is the JSON form of a co-occurrence engine
+type coOccurrenceJSON struct {
+	Values    *CountMinSketch `json:"values"`
+	Pairs     *CountMinSketch `json:"pairs"`
+	Documents uint64          `json:"documents"`
+}
+
+// MarshalJSON encodes the sketches of the values and pairs of values seen by
+// the co-occurrence engine as JSON, the selected fields are an option
+func (c *CoOccurrence) MarshalJSON() ([]byte, error) {
+	return json.Marshal(coOccurrenceJSON{
+		Values:    c.Values,
+		Pairs:     c.Pairs,
+		Documents: c.Documents,
+	})
+}
+
+// UnmarshalJSON decodes the sketches of the values and pairs of values seen
+// by the co-occurrence engine from JSON
+func (c *CoOccurrence) UnmarshalJSON(data []byte) error {
+	var snapshot coOccurrenceJSON
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return err
+	}
+	if err = snapshot.Values.check(coOccurrenceWidth, coOccurrenceDepth); err != nil {
+		return err
+	}
+	if err = snapshot.Pairs.check(coOccurrenceWidth, coOccurrenceDepth); err != nil {
+		return err
+	}
+	c.Values, c.Pairs, c.Documents = snapshot.Values, snapshot.Pairs, snapshot.Documents
+	return nil
+}
+
+// autoencoderJSON is the JSON form of an autoencoder
+type autoencoderJSON struct {
+	Weights [][][]float32 `json:"weights"`
+	Changes [][][]float32 `json:"changes"`
+	Replay  [][]float32   `json:"replay,omitempty"`
+	Seen    int           `json:"seen"`
+}
+
+// sameShape checks that two sets of weights have the same shape
+func sameShape(a, b [][][]float32) error {
+	if len(a) != len(b) {
+		return fmt.Errorf("%d layers, not %d", len(a), len(b))
+	}
+	for i := range a {
+		if len(a[i]) != len(b[i]) {
+			return fmt.Errorf("layer %d has %d rows, not %d", i, len(a[i]), len(b[i]))
+		}
+		for j := range a[i] {
+			if len(a[i][j]) != len(b[i][j]) {
+				return fmt.Errorf("row %d of layer %d has %d weights, not %d", j, i, len(a[i][j]), len(b[i][j]))
+			}
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the weights and the replay buffer of the autoencoder
+// as JSON
+func (a *Autoencoder) MarshalJSON() ([]byte, error) {
+	return json.Marshal(autoencoderJSON{
+		Weights: a.Neural32.Weights,
+		Changes: a.Neural32.Changes,
+		Replay:  a.replay,
+		Seen:    a.seen,
+	})
+}
+
+// UnmarshalJSON decodes the weights and the replay buffer of the autoencoder
+// from JSON, the weights must have the shape of the autoencoder
+func (a *Autoencoder) UnmarshalJSON(data []byte) error {
+	var snapshot autoencoderJSON
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return err
+	}
+	if err = sameShape(snapshot.Weights, a.Neural32.Weights); err != nil {
+		return err
+	}
+	if err = sameShape(snapshot.Changes, a.Neural32.Changes); err != nil {
+		return err
+	}
+	if len(snapshot.Replay) > a.Replay {
+		return fmt.Errorf("%d replayed vectors, more than %d", len(snapshot.Replay), a.Replay)
+	}
+	if snapshot.Seen < len(snapshot.Replay) {
+		return fmt.Errorf("%d vectors seen, fewer than %d", snapshot.Seen, len(snapshot.Replay))
+	}
+	for _, vector := range snapshot.Replay {
+		if len(vector) != a.Vectorizer.Size {
+			return fmt.Errorf("vector has size %d, not %d", len(vector), a.Vectorizer.Size)
+		}
+	}
+	a.Neural32.Weights, a.Neural32.Changes = snapshot.Weights, snapshot.Changes
+	a.replay, a.seen = snapshot.Replay, snapshot.Seen
+	return nil
+}
+
+// vaeJSON is the JSON form of a variational autoencoder
+type vaeJSON struct {
+	Weights   map[string][]float32 `json:"weights"`
+	Optimizer *rnn.Optimizer       `json:"optimizer"`
+}
+
+// MarshalJSON encodes the weights and the optimizer of the variational
+// autoencoder as JSON
+func (v *VAE) MarshalJSON() ([]byte, error) {
+	return json.Marshal(vaeJSON{
+		Weights:   rnn.Weights(v.learner.Nodes),
+		Optimizer: v.optimizer,
+	})
+}
+
+// UnmarshalJSON decodes the weights and the optimizer of the variational
+// autoencoder from JSON, the weights must have the sizes of the autoencoder
+func (v *VAE) UnmarshalJSON(data []byte) error {
+	var snapshot vaeJSON
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return err
+	}
+	if snapshot.Optimizer == nil {
+		return errors.New("variational autoencoder has no optimizer")
+	}
+	if err = snapshot.Optimizer.Check(v.learner.Nodes); err != nil {
+		return err
+	}
+	if err = rnn.SetWeights(v.learner.Nodes, snapshot.Weights); err != nil {
+		return err
+	}
+	v.learner.clamp()
+	v.optimizer = snapshot.Optimizer
+	return nil
+}
+
+// recurrentEmbeddingJSON is the JSON form of a recurrent embedding engine
+type recurrentEmbeddingJSON struct {
+	Engine  json.RawMessage `json:"engine"`
+	Vectors json.RawMessage `json:"vectors"`
+}
+
+// MarshalJSON encodes the recurrent engine and the vector engine of the
+// embedding as JSON, the vector engine must be persistent
+func (r *RecurrentEmbedding) MarshalJSON() ([]byte, error) {
+	vectors, ok := r.Vectors.(Persistent)
+	if !ok {
+		return nil, ErrNotPersistent
+	}
+	var snapshot recurrentEmbeddingJSON
+	var err error
+	if snapshot.Engine, err = r.Engine.MarshalJSON(); err != nil {
+		return nil, err
+	}
+	if snapshot.Vectors, err = vectors.MarshalJSON(); err != nil {
+		return nil, err
+	}
+	return json.Marshal(snapshot)
+}
+
+// UnmarshalJSON decodes the recurrent engine and the vector engine of the
+// embedding from JSON
+func (r *RecurrentEmbedding) UnmarshalJSON(data []byte) error {
+	vectors, ok := r.Vectors.(Persistent)
+	if !ok {
+		return ErrNotPersistent
+	}
+	var snapshot recurrentEmbeddingJSON
+	err := json.Unmarshal(data, &snapshot)
+	if err != nil {
+		return err
+	}
+	if err = vectors.UnmarshalJSON(snapshot.Vectors); err != nil {
+		return err
+	}
+	return r.Engine.UnmarshalJSON(snapshot.Engine)
+}
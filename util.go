@@ -68,12 +68,32 @@ func Normalize(a []int64) []float32 {
 	}
 	sum = math.Sqrt(sum)
 	b := make([]float32, len(a))
+	if sum == 0 {
+		return b
+	}
 	for i, v := range a {
 		b[i] = float32(v) / float32(sum)
 	}
 	return b
 }
 
+// Normalize32 converts a float32 vector to a unit vector
+func Normalize32(a []float32) []float32 {
+	sum := 0.0
+	for _, v := range a {
+		sum += float64(v) * float64(v)
+	}
+	sum = math.Sqrt(sum)
+	b := make([]float32, len(a))
+	if sum == 0 {
+		return b
+	}
+	for i, v := range a {
+		b[i] = float32(float64(v) / sum)
+	}
+	return b
+}
+
 // Adapt prepares a vector for input into a neural network
 func Adapt(a []float32) []float32 {
 	b := make([]float32, len(a))
@@ -95,3 +115,12 @@ func Similarity(a, b []float32) float64 {
 	}
 	return dot / math.Sqrt(xx*yy)
 }
+
+// formatPath formats a context as a JSON path
+func formatPath(context []string) string {
+	path := "$"
+	for _, key := range context {
+		path += "." + key
+	}
+	return path
+}
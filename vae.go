@@ -0,0 +1,280 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"errors"
+	"math"
+	"math/rand"
+
+	gg "gorgonia.org/gorgonia"
+	"gorgonia.org/tensor"
+
+	"github.com/pointlander/anomaly/rnn"
+)
+
+// VAEOptions are the hyperparameters of a variational autoencoder
+type VAEOptions struct {
+	// Hidden is the size of the hidden layers of the encoder and decoder
+	Hidden int
+	// Latent is the number of latent variables
+	Latent int
+	// Samples is the number of samples of the latent variables used for
+	// scoring without learning
+	Samples   int
+	LearnRate float64
+}
+
+// DefaultVAEOptions returns the default hyperparameters of a variational
+// autoencoder
+func DefaultVAEOptions() VAEOptions {
+	return VAEOptions{
+		Hidden:    64,
+		Latent:    8,
+		Samples:   8,
+		LearnRate: 0.001,
+	}
+}
+
+// Validate checks the options
+func (o *VAEOptions) Validate() error {
+	if o.Hidden < 1 || o.Latent < 1 {
+		return errors.New("hidden and latent sizes must be at least 1")
+	}
+	if o.Samples < 0 {
+		return errors.New("samples can't be negative")
+	}
+	return nil
+}
+
+// vaeLogVarBound bounds the learned log variance of each entry of a vector,
+// so its exponential stays finite
+const vaeLogVarBound = 10
+
+// vaeGraph computes the negative evidence lower bound of a vector
+type vaeGraph struct {
+	*gg.ExprGraph
+	gg.VM
+	gg.Nodes
+	X, Epsilon         *tensor.Dense
+	Reconstruction, KL *gg.Node
+}
+
+// newVAEGraph builds the graph of a variational autoencoder with the given
+// weights, the gradients are computed when learning
+func newVAEGraph(weights []*tensor.Dense, width, latent int, learn bool) *vaeGraph {
+	g := gg.NewGraph()
+	v := &vaeGraph{
+		ExprGraph: g,
+		X:         tensor.NewDense(tensor.Float32, tensor.Shape{width}),
+		Epsilon:   tensor.NewDense(tensor.Float32, tensor.Shape{latent}),
+	}
+	names := []string{"we", "be", "wm", "bm", "wv", "bv", "wd", "bd", "wo", "bo", "logvar"}
+	w := make(gg.Nodes, len(weights))
+	for i, weight := range weights {
+		w[i] = gg.NodeFromAny(g, weight, gg.WithName(names[i]))
+	}
+	v.Nodes = w
+
+	x := gg.NewVector(g, tensor.Float32, gg.WithShape(width), gg.WithName("x"), gg.WithValue(v.X))
+	epsilon := gg.NewVector(g, tensor.Float32, gg.WithShape(latent), gg.WithName("epsilon"), gg.WithValue(v.Epsilon))
+	one := gg.NewConstant(float32(1))
+	half := gg.NewConstant(float32(.5))
+	layer := func(w, b, x *gg.Node) *gg.Node {
+		return gg.Must(gg.Add(gg.Must(gg.Mul(w, x)), b))
+	}
+
+	h := gg.Must(gg.Tanh(layer(w[0], w[1], x)))
+	mu := layer(w[2], w[3], h)
+	logvar := layer(w[4], w[5], h)
+	z := gg.Must(gg.Add(mu, gg.Must(gg.HadamardProd(gg.Must(gg.Exp(gg.Must(gg.Mul(logvar, half)))), epsilon))))
+	output := layer(w[8], w[9], gg.Must(gg.Tanh(layer(w[6], w[7], z))))
+
+	// negative log likelihood of a gaussian with a learned variance for each
+	// entry, without the constant term
+	d := gg.Must(gg.Square(gg.Must(gg.Sub(x, output))))
+	nll := gg.Must(gg.Add(gg.Must(gg.HadamardProd(d, gg.Must(gg.Exp(gg.Must(gg.Neg(w[10])))))), w[10]))
+	v.Reconstruction = gg.Must(gg.Mul(gg.Must(gg.Sum(nll)), half))
+
+	kl := gg.Must(gg.Sub(gg.Must(gg.Add(gg.Must(gg.Square(mu)), gg.Must(gg.Exp(logvar)))), gg.Must(gg.Add(logvar, one))))
+	v.KL = gg.Must(gg.Mul(gg.Must(gg.Sum(kl)), half))
+
+	if learn {
+		cost := gg.Must(gg.Add(v.Reconstruction, v.KL))
+		_, err := gg.Grad(cost, w...)
+		if err != nil {
+			panic(err)
+		}
+		v.VM = gg.NewTapeMachine(g, gg.BindDualValues(w...))
+	} else {
+		v.VM = gg.NewTapeMachine(g)
+	}
+	return v
+}
+
+// clamp clamps the learned log variance of each entry to [-vaeLogVarBound,
+// vaeLogVarBound]
+func (v *vaeGraph) clamp() {
+	logvar := v.Nodes[len(v.Nodes)-1].Value().Data().([]float32)
+	for i, value := range logvar {
+		if value > vaeLogVarBound {
+			logvar[i] = vaeLogVarBound
+		} else if value < -vaeLogVarBound {
+			logvar[i] = -vaeLogVarBound
+		}
+	}
+}
+
+// run computes the reconstruction and KL terms of a unit vector for a sample
+// of the latent variables
+func (v *vaeGraph) run(rnd *rand.Rand, unit []float32) (reconstruction, kl float32) {
+	v.clamp()
+	scale := float32(math.Sqrt(float64(len(unit))))
+	for i, value := range unit {
+		v.X.SetAt(value*scale, i)
+	}
+	for i := range v.Epsilon.Data().([]float32) {
+		v.Epsilon.SetAt(float32(rnd.NormFloat64()), i)
+	}
+	err := v.RunAll()
+	if err != nil {
+		panic(err)
+	}
+	reconstruction = v.Reconstruction.Value().Data().(float32)
+	kl = v.KL.Value().Data().(float32)
+	return reconstruction + float32(len(unit))*float32(math.Log(2*math.Pi))/2, kl
+}
+
+// VAE is a variational autoencoder, the surprise of a document vector is its
+// negative evidence lower bound
+// https://arxiv.org/abs/1312.6114
+type VAE struct {
+	VAEOptions
+	learner, scorer *vaeGraph
+	optimizer       *rnn.Optimizer
+	rnd             *rand.Rand
+	*Vectorizer
+}
+
+// NewVAE creates a new variational autoencoder
+func NewVAE(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+	return NewVAEFactory(DefaultVAEOptions())(rnd, vectorizer)
+}
+
+// NewVAEFactory creates a factory for variational autoencoders with the given
+// hyperparameters, it panics if the options aren't valid
+func NewVAEFactory(options VAEOptions) NetworkFactory {
+	if err := options.Validate(); err != nil {
+		panic(err)
+	}
+	return func(rnd *rand.Rand, vectorizer *Vectorizer) Network {
+		random32 := func(a, b float32) float32 {
+			return (b-a)*rnd.Float32() + a
+		}
+		matrix := func(rows, cols int) *tensor.Dense {
+			m := tensor.NewDense(tensor.Float32, tensor.Shape{rows, cols})
+			fanIn := float32(math.Sqrt(float64(cols)))
+			for i := range m.Data().([]float32) {
+				m.Data().([]float32)[i] = random32(-1, 1) / fanIn
+			}
+			return m
+		}
+		vector := func(size int) *tensor.Dense {
+			return tensor.NewDense(tensor.Float32, tensor.Shape{size})
+		}
+		width, hidden, latent := vectorizer.Size, options.Hidden, options.Latent
+		weights := []*tensor.Dense{
+			matrix(hidden, width), vector(hidden),
+			matrix(latent, hidden), vector(latent),
+			matrix(latent, hidden), vector(latent),
+			matrix(hidden, latent), vector(hidden),
+			matrix(width, hidden), vector(width),
+			vector(width),
+		}
+		adam := rnn.Options{Solver: rnn.SolverAdam, LearnRate: options.LearnRate}
+		return &VAE{
+			VAEOptions: options,
+			learner:    newVAEGraph(weights, width, latent, true),
+			scorer:     newVAEGraph(weights, width, latent, false),
+			optimizer:  adam.NewOptimizer(),
+			rnd:        rnd,
+			Vectorizer: vectorizer,
+		}
+	}
+}
+
+// ScoreVectorTerms computes the reconstruction and KL terms of the negative
+// evidence lower bound of a unit vector without learning. The reconstruction
+// term is averaged over samples of the latent variables
+func (v *VAE) ScoreVectorTerms(unit []float32) (reconstruction, kl float32) {
+	samples := v.Samples
+	if samples < 1 {
+		samples = 1
+	}
+	for i := 0; i < samples; i++ {
+		r, k := v.scorer.run(v.rnd, unit)
+		v.scorer.Reset()
+		reconstruction += r
+		kl = k
+	}
+	return reconstruction / float32(samples), kl
+}
+
+// ScoreVector computes the negative evidence lower bound of a unit vector
+// without learning
+func (v *VAE) ScoreVector(unit []float32) float32 {
+	reconstruction, kl := v.ScoreVectorTerms(unit)
+	return reconstruction + kl
+}
+
+// Train computes the negative evidence lower bound of a document and learns
+// from it. The uncertainty is the KL term of the bound
+func (v *VAE) Train(input []byte) (surprise, uncertainty float32) {
+	var object map[string]interface{}
+	err := json.Unmarshal(input, &object)
+	if err != nil {
+		panic(err)
+	}
+	vector := v.Vectorizer.Vectorize(object)
+	reconstruction, kl := v.TrainVectorTerms(Normalize(vector))
+	return reconstruction + kl, kl
+}
+
+// KL computes the KL divergence of the latent distribution of a document from
+// the prior without learning, it measures how unusual the encoding of the
+// document is
+func (v *VAE) KL(input []byte) float32 {
+	var object map[string]interface{}
+	err := json.Unmarshal(input, &object)
+	if err != nil {
+		panic(err)
+	}
+	vector := v.Vectorizer.Vectorize(object)
+	_, kl := v.scorer.run(v.rnd, Normalize(vector))
+	v.scorer.Reset()
+	return kl
+}
+
+// TrainVector computes the negative evidence lower bound of a unit vector and
+// learns from it
+func (v *VAE) TrainVector(unit []float32) float32 {
+	reconstruction, kl := v.TrainVectorTerms(unit)
+	return reconstruction + kl
+}
+
+// TrainVectorTerms computes the reconstruction and KL terms of the negative
+// evidence lower bound of a unit vector for a sample of the latent variables
+// and learns from it
+func (v *VAE) TrainVectorTerms(unit []float32) (reconstruction, kl float32) {
+	reconstruction, kl = v.learner.run(v.rnd, unit)
+	defer v.learner.Reset()
+	err := v.optimizer.Update(v.learner.Nodes)
+	if err != nil {
+		panic(err)
+	}
+	v.learner.clamp()
+	return reconstruction, kl
+}
@@ -0,0 +1,44 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+// TestVAE checks the surprise and KL divergence of the variational
+// autoencoder, and that the log variance of each entry is clamped
+func TestVAE(t *testing.T) {
+	options := DefaultVAEOptions()
+	options.Hidden, options.Latent = 8, 2
+	vae := NewVAEFactory(options)(rand.New(rand.NewSource(1)), NewVectorizer(64, true, NewLFSR32Source)).(*VAE)
+	logvar := vae.learner.Nodes[len(vae.learner.Nodes)-1].Value().Data().([]float32)
+	for i := range logvar {
+		logvar[i] = 100
+		if i%2 == 0 {
+			logvar[i] = -100
+		}
+	}
+
+	document := []byte(`{"user":"alice","action":"login","ok":true}`)
+	surprise, uncertainty := vae.Train(document)
+	if math.IsNaN(float64(surprise)) || math.IsInf(float64(surprise), 0) {
+		t.Errorf("surprise is %v", surprise)
+	}
+	// the uncertainty is the KL term
+	if !(uncertainty > 0) || math.IsInf(float64(uncertainty), 0) {
+		t.Errorf("uncertainty is %v, expected a positive KL term", uncertainty)
+	}
+	for i, value := range logvar {
+		if value < -vaeLogVarBound || value > vaeLogVarBound {
+			t.Errorf("log variance %d is %v", i, value)
+		}
+	}
+	if kl := vae.KL(document); !(kl >= 0) || math.IsInf(float64(kl), 0) {
+		t.Errorf("KL divergence is %v", kl)
+	}
+}
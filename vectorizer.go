@@ -9,10 +9,14 @@ import (
 	"fmt"
 	"hash/fnv"
 	"sync"
+	"sync/atomic"
 )
 
 // Vectorizer converts JSON documents to vectors
 type Vectorizer struct {
+	// Hits and Misses count the lookups of the matrix column cache, they are
+	// first so they are aligned for atomic access
+	Hits, Misses      uint64
 	Size              int
 	UseCache          bool
 	MatrixColumnCache map[uint64][]int8
@@ -39,6 +43,19 @@ func hash(a []string) uint64 {
 	return h.Sum64()
 }
 
+// hashWord hashes the strings of a word separated by "\x00", so that words
+// with the same concatenation don't collide
+func hashWord(a []string) uint64 {
+	h := fnv.New64()
+	for i, s := range a {
+		if i > 0 {
+			h.Write([]byte{0})
+		}
+		h.Write([]byte(s))
+	}
+	return h.Sum64()
+}
+
 // AddMatrixColumn finds or generates a matrix column and adds it to a vector
 func (v *Vectorizer) AddMatrixColumn(a []string, b []int64) {
 	h := hash(a)
@@ -54,11 +71,13 @@ func (v *Vectorizer) AddMatrixColumn(a []string, b []int64) {
 	transform, found := v.MatrixColumnCache[h]
 	v.RUnlock()
 	if found {
+		atomic.AddUint64(&v.Hits, 1)
 		for i := range b {
 			b[i] += int64(transform[i])
 		}
 		return
 	}
+	atomic.AddUint64(&v.Misses, 1)
 	transform = make([]int8, v.Size)
 	rnd := v.Source(h)
 	for i := range transform {
@@ -71,42 +90,85 @@ func (v *Vectorizer) AddMatrixColumn(a []string, b []int64) {
 	v.Unlock()
 }
 
-// Vectorize produces a vector from a JSON object
-func (v *Vectorizer) Vectorize(object map[string]interface{}) []int64 {
-	vector := make([]int64, v.Size)
+// CacheSize is the number of matrix columns in the cache
+func (v *Vectorizer) CacheSize() int {
+	v.RLock()
+	defer v.RUnlock()
+	return len(v.MatrixColumnCache)
+}
+
+// Walk calls visit with the context and value of each value in a JSON object
+// that isn't an object or an array. Values in nested arrays are skipped. The
+// context is only valid for the duration of the call
+func Walk(object map[string]interface{}, visit func(context []string, value interface{})) {
+	walk(object, make([]string, 0, 256), true, visit)
+}
+
+// walk walks a JSON object nested within a context. Objects in arrays are
+// always walked, objects nested directly under a key only when nested is true
+func walk(object map[string]interface{}, context []string, nested bool, visit func(context []string, value interface{})) {
 	var process func(object map[string]interface{}, context []string)
 	process = func(object map[string]interface{}, context []string) {
 		for key, value := range object {
 			sub := append(context, key)
-			sum := func(value string) {
-				subvalue := append(sub, value)
-				for i := range subvalue {
-					v.AddMatrixColumn(subvalue[i:], vector)
-				}
-			}
 			switch value := value.(type) {
+			case map[string]interface{}:
+				if nested {
+					process(value, sub)
+				}
 			case []interface{}:
 				for _, value := range value {
 					switch value := value.(type) {
 					case map[string]interface{}:
 						process(value, sub)
-					case string:
-						sum(value)
-					case float64:
-						sum(fmt.Sprintf("%f", value))
-					case json.Number:
-						sum(value.String())
+					case []interface{}:
+					default:
+						visit(sub, value)
 					}
 				}
-			case string:
-				sum(value)
-			case float64:
-				sum(fmt.Sprintf("%f", value))
-			case json.Number:
-				sum(value.String())
+			default:
+				visit(sub, value)
 			}
 		}
 	}
-	process(object, make([]string, 0, 256))
+	process(object, context)
+}
+
+// Words calls visit with each path/value word of a JSON object that Vectorize
+// adds to a vector. Like Vectorize it skips objects nested directly under a
+// key. The word is only valid for the duration of the call
+func Words(object map[string]interface{}, visit func(word []string)) {
+	words(object, make([]string, 0, 256), visit)
+}
+
+// words calls visit with each path/value word of a JSON object nested within
+// a context
+func words(object map[string]interface{}, context []string, visit func(word []string)) {
+	walk(object, context, false, func(context []string, value interface{}) {
+		switch value := value.(type) {
+		case string:
+			visit(append(context, value))
+		case float64:
+			visit(append(context, fmt.Sprintf("%f", value)))
+		case json.Number:
+			visit(append(context, value.String()))
+		}
+	})
+}
+
+// Vectorize produces a vector from a JSON object
+func (v *Vectorizer) Vectorize(object map[string]interface{}) []int64 {
+	return v.VectorizeContext(object, nil)
+}
+
+// VectorizeContext produces a vector from a JSON object nested within the
+// context of its parent keys
+func (v *Vectorizer) VectorizeContext(object map[string]interface{}, context []string) []int64 {
+	vector := make([]int64, v.Size)
+	words(object, append(make([]string, 0, 256), context...), func(word []string) {
+		for i := range word {
+			v.AddMatrixColumn(word[i:], vector)
+		}
+	})
 	return vector
 }
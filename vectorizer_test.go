@@ -0,0 +1,76 @@
+// Copyright 2017 The Anomaly Authors. All rights reserved.
+// Use of this source code is governed by a BSD-style
+// license that can be found in the LICENSE file.
+
+package anomaly
+
+import (
+	"encoding/json"
+	"reflect"
+	"sort"
+	"strings"
+	"testing"
+)
+
+// TestWords checks the path/value words of documents, objects nested directly
+// under a key aren't vectorized
+func TestWords(t *testing.T) {
+	tests := []struct {
+		document string
+		words    []string
+	}{
+		{`{}`, nil},
+		{`{"a":"x","b":1}`, []string{"a/x", "b/1.000000"}},
+		{`{"a":["x",2,true,null,["y"]]}`, []string{"a/2.000000", "a/x"}},
+		{`{"a":[{"b":"x"},{"c":"y"}]}`, []string{"a/b/x", "a/c/y"}},
+		{`{"a":{"b":"x"},"c":"y"}`, []string{"c/y"}},
+		{`{"a":[{"b":{"c":"x"},"d":"y"}]}`, []string{"a/d/y"}},
+	}
+	for _, test := range tests {
+		var object map[string]interface{}
+		if err := json.Unmarshal([]byte(test.document), &object); err != nil {
+			t.Fatal(err)
+		}
+		var words []string
+		Words(object, func(word []string) {
+			words = append(words, strings.Join(word, "/"))
+		})
+		sort.Strings(words)
+		if !reflect.DeepEqual(words, test.words) {
+			t.Errorf("%s: words are %q, expected %q", test.document, words, test.words)
+		}
+	}
+}
+
+// TestWalk checks that Walk visits the values of all nested objects
+func TestWalk(t *testing.T) {
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"a":{"b":"x"},"c":[{"d":1},[2]],"e":null}`), &object); err != nil {
+		t.Fatal(err)
+	}
+	var paths []string
+	Walk(object, func(context []string, value interface{}) {
+		paths = append(paths, strings.Join(context, "/"))
+	})
+	sort.Strings(paths)
+	if expected := []string{"a/b", "c/d", "e"}; !reflect.DeepEqual(paths, expected) {
+		t.Errorf("paths are %q, expected %q", paths, expected)
+	}
+}
+
+// TestVectorize checks that a vector is the sum of the matrix columns of the
+// suffixes of the words of a document
+func TestVectorize(t *testing.T) {
+	vectorizer := NewVectorizer(16, true, NewLFSR32Source)
+	var object map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"a":{"b":"x"},"c":[{"d":"y"}]}`), &object); err != nil {
+		t.Fatal(err)
+	}
+	expected := make([]int64, 16)
+	for _, suffix := range [][]string{{"c", "d", "y"}, {"d", "y"}, {"y"}} {
+		vectorizer.AddMatrixColumn(suffix, expected)
+	}
+	if vector := vectorizer.Vectorize(object); !reflect.DeepEqual(vector, expected) {
+		t.Errorf("vector is %v, expected %v", vector, expected)
+	}
+}